@@ -0,0 +1,492 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package breaker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/voidint/box/ecache"
+)
+
+var (
+	_ ecache.Cache          = (*cache)(nil) // Ensure cache implements ecache.Cache interface.
+	_ ecache.VersionedCache = (*cache)(nil) // Ensure cache implements ecache.VersionedCache interface.
+	_ ecache.TaggedCache    = (*cache)(nil) // Ensure cache implements ecache.TaggedCache interface.
+	_ ecache.ExpiringCache  = (*cache)(nil) // Ensure cache implements ecache.ExpiringCache interface.
+	_ ecache.Locker         = (*cache)(nil) // Ensure cache implements ecache.Locker interface.
+	_ ecache.Unwrapper      = (*cache)(nil) // Ensure cache implements ecache.Unwrapper interface.
+)
+
+// ErrCircuitOpen is returned by reads and deletes while the circuit is open.
+// IsKeyNotFound reports it as a cache miss, so the entity helpers fall
+// back to their loaders, while invalidations such as DelCachedEntity fail
+// instead of reporting success for entries left in place.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// State is the state of the circuit breaker
+type State int
+
+const (
+	// Closed lets every request through, counting consecutive failures
+	Closed State = iota
+	// Open rejects every request until the open timeout elapses
+	Open
+	// HalfOpen lets a few probe requests through to test recovery
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+const (
+	// DefaultFailureThreshold is the default number of consecutive failures
+	// opening the circuit
+	DefaultFailureThreshold = 5
+	// DefaultOpenTimeout is the default time the circuit stays open before probing
+	DefaultOpenTimeout = 5 * time.Second
+	// DefaultHalfOpenProbes is the default number of concurrent probe requests
+	DefaultHalfOpenProbes = 1
+)
+
+// WithFailureThreshold sets the number of consecutive failures opening the circuit
+func WithFailureThreshold(n int) func(*cache) {
+	return func(c *cache) {
+		c.threshold = n
+	}
+}
+
+// WithOpenTimeout sets how long the circuit stays open before probing
+func WithOpenTimeout(timeout time.Duration) func(*cache) {
+	return func(c *cache) {
+		c.openTimeout = timeout
+	}
+}
+
+// WithHalfOpenProbes sets the number of concurrent probe requests let
+// through while half-open. Requests beyond it are rejected as if open.
+func WithHalfOpenProbes(n int) func(*cache) {
+	return func(c *cache) {
+		c.probes = n
+	}
+}
+
+// WithStateChange sets a callback invoked on every state transition, e.g.
+// for logging or metrics. It is called with the breaker locked, so it must
+// not call back into the cache.
+func WithStateChange(fn func(from, to State)) func(*cache) {
+	return func(c *cache) {
+		c.onChange = fn
+	}
+}
+
+// cache guards a cache (typically ecache/redis) with a circuit breaker.
+// After consecutive failures the circuit opens: reads fail with
+// ErrCircuitOpen, reported as cache misses, and writes are skipped, so
+// lookups degrade to the loaders instead of failing. Deletes fail with
+// ErrCircuitOpen, as the entries they leave behind would be served stale
+// once the circuit closes. After the open timeout, probe requests decide
+// whether the circuit closes again.
+//
+// The optional interfaces of ecache are forwarded to the inner cache,
+// and are in effect when it implements them (see ecache.As).
+//
+// Cache misses are not failures. Neither are errors of requests whose
+// context is done, as they say nothing about the health of the cache.
+// Skipped writes leave the previous entry of their key in place, so
+// writes replacing entries, such as write-through saves, should be paired
+// with invalidation (see ecache.WithSaveInvalidation).
+type cache struct {
+	inner       ecache.Cache
+	threshold   int
+	openTimeout time.Duration
+	probes      int
+	onChange    func(from, to State)
+	now         func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int       // Consecutive failures while closed
+	openedAt time.Time // Start of the current open state
+	inFlight int       // Probe requests in flight while half-open
+}
+
+// NewCache creates a cache guarded by a circuit breaker.
+// inner: Cache to guard, typically ecache/redis
+func NewCache(inner ecache.Cache, opts ...func(*cache)) *cache {
+	c := cache{
+		inner:       inner,
+		threshold:   DefaultFailureThreshold,
+		openTimeout: DefaultOpenTimeout,
+		probes:      DefaultHalfOpenProbes,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return &c
+}
+
+// State returns the current state of the circuit breaker
+func (c *cache) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == Open && c.now().Sub(c.openedAt) >= c.openTimeout {
+		return HalfOpen
+	}
+	return c.state
+}
+
+// Del removes multiple keys from the inner cache.
+// Returns ErrCircuitOpen while the circuit is open.
+func (c *cache) Del(ctx context.Context, keys ...string) (affected int64, err error) {
+	probe, ok := c.allow()
+	if !ok {
+		return 0, errors.WithStack(ErrCircuitOpen)
+	}
+	affected, err = c.inner.Del(ctx, keys...)
+	c.done(ctx, probe, err)
+	if err != nil {
+		return affected, errors.WithStack(err)
+	}
+	return affected, nil
+}
+
+// Get retrieves byte slice value from the inner cache.
+// Returns ErrCircuitOpen while the circuit is open.
+func (c *cache) Get(ctx context.Context, key string) (val []byte, err error) {
+	probe, ok := c.allow()
+	if !ok {
+		return nil, errors.WithStack(ErrCircuitOpen)
+	}
+	val, err = c.inner.Get(ctx, key)
+	c.done(ctx, probe, err)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return val, nil
+}
+
+// Set stores value in the inner cache.
+// Skipped while the circuit is open.
+func (c *cache) Set(ctx context.Context, key string, val []byte, expire time.Duration) (err error) {
+	probe, ok := c.allow()
+	if !ok {
+		return nil
+	}
+	err = c.inner.Set(ctx, key, val, expire)
+	c.done(ctx, probe, err)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// GetAsUint64 retrieves uint64 value from the inner cache.
+// Returns ErrCircuitOpen while the circuit is open.
+func (c *cache) GetAsUint64(ctx context.Context, key string) (val uint64, err error) {
+	probe, ok := c.allow()
+	if !ok {
+		return 0, errors.WithStack(ErrCircuitOpen)
+	}
+	val, err = c.inner.GetAsUint64(ctx, key)
+	c.done(ctx, probe, err)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return val, nil
+}
+
+// SetUint64 stores uint64 value in the inner cache.
+// Skipped while the circuit is open.
+func (c *cache) SetUint64(ctx context.Context, key string, val uint64, expire time.Duration) (err error) {
+	probe, ok := c.allow()
+	if !ok {
+		return nil
+	}
+	err = c.inner.SetUint64(ctx, key, val, expire)
+	c.done(ctx, probe, err)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// MGet retrieves values from the inner cache.
+// Every key is reported missing while the circuit is open.
+func (c *cache) MGet(ctx context.Context, keys ...string) (vals [][]byte, err error) {
+	probe, ok := c.allow()
+	if !ok {
+		return make([][]byte, len(keys)), nil
+	}
+	vals, err = c.inner.MGet(ctx, keys...)
+	c.done(ctx, probe, err)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return vals, nil
+}
+
+// MSet stores multiple values in the inner cache.
+// Skipped while the circuit is open.
+func (c *cache) MSet(ctx context.Context, items map[string][]byte, expire time.Duration) (err error) {
+	probe, ok := c.allow()
+	if !ok {
+		return nil
+	}
+	err = c.inner.MSet(ctx, items, expire)
+	c.done(ctx, probe, err)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Unwrap returns the inner cache
+func (c *cache) Unwrap() ecache.Cache {
+	return c.inner
+}
+
+// Version retrieves the generation of key from the inner cache.
+// Returns 0 while the circuit is open: writes against it are skipped
+// until the circuit closes, and discarded if key was invalidated since.
+// Returns ecache.ErrUnsupported if the inner cache has no key generations.
+func (c *cache) Version(ctx context.Context, key string) (version uint64, err error) {
+	vc, ok := c.inner.(ecache.VersionedCache)
+	if !ok {
+		return 0, errors.WithStack(ecache.ErrUnsupported)
+	}
+	probe, ok := c.allow()
+	if !ok {
+		return 0, nil
+	}
+	version, err = vc.Version(ctx, key)
+	c.done(ctx, probe, err)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return version, nil
+}
+
+// SetIfVersion stores value in the inner cache if the generation of key
+// still equals version.
+// Skipped, and reported as discarded, while the circuit is open.
+func (c *cache) SetIfVersion(ctx context.Context, key string, version uint64, val []byte, expire time.Duration) (ok bool, err error) {
+	vc, ok := c.inner.(ecache.VersionedCache)
+	if !ok {
+		return false, errors.WithStack(ecache.ErrUnsupported)
+	}
+	probe, ok := c.allow()
+	if !ok {
+		return false, nil
+	}
+	ok, err = vc.SetIfVersion(ctx, key, version, val, expire)
+	c.done(ctx, probe, err)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return ok, nil
+}
+
+// Invalidate deletes keys from the inner cache and bumps their generations.
+// Returns ErrCircuitOpen while the circuit is open.
+func (c *cache) Invalidate(ctx context.Context, keys ...string) (affected int64, err error) {
+	vc, ok := c.inner.(ecache.VersionedCache)
+	if !ok {
+		return 0, errors.WithStack(ecache.ErrUnsupported)
+	}
+	probe, ok := c.allow()
+	if !ok {
+		return 0, errors.WithStack(ErrCircuitOpen)
+	}
+	affected, err = vc.Invalidate(ctx, keys...)
+	c.done(ctx, probe, err)
+	if err != nil {
+		return affected, errors.WithStack(err)
+	}
+	return affected, nil
+}
+
+// Tag adds keys to the tag index of the inner cache.
+// Skipped while the circuit is open, like the writes of the keys.
+// Returns ecache.ErrTagsUnsupported if the inner cache has no tag index.
+func (c *cache) Tag(ctx context.Context, tag string, expire time.Duration, keys ...string) (err error) {
+	tc, ok := c.inner.(ecache.TaggedCache)
+	if !ok {
+		return errors.WithStack(ecache.ErrTagsUnsupported)
+	}
+	probe, ok := c.allow()
+	if !ok {
+		return nil
+	}
+	err = tc.Tag(ctx, tag, expire, keys...)
+	c.done(ctx, probe, err)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// PopTag retrieves and removes the tag index of the inner cache.
+// Returns ErrCircuitOpen while the circuit is open.
+func (c *cache) PopTag(ctx context.Context, tag string) (keys []string, err error) {
+	tc, ok := c.inner.(ecache.TaggedCache)
+	if !ok {
+		return nil, errors.WithStack(ecache.ErrTagsUnsupported)
+	}
+	probe, ok := c.allow()
+	if !ok {
+		return nil, errors.WithStack(ErrCircuitOpen)
+	}
+	keys, err = tc.PopTag(ctx, tag)
+	c.done(ctx, probe, err)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return keys, nil
+}
+
+// TTL retrieves the remaining time-to-live of entries from the inner cache.
+// Returns ErrCircuitOpen while the circuit is open.
+func (c *cache) TTL(ctx context.Context, keys ...string) (ttls []time.Duration, err error) {
+	ec, ok := c.inner.(ecache.ExpiringCache)
+	if !ok {
+		return nil, errors.WithStack(ecache.ErrUnsupported)
+	}
+	probe, ok := c.allow()
+	if !ok {
+		return nil, errors.WithStack(ErrCircuitOpen)
+	}
+	ttls, err = ec.TTL(ctx, keys...)
+	c.done(ctx, probe, err)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return ttls, nil
+}
+
+// TryLock acquires lock key in the inner cache.
+// Returns ErrCircuitOpen while the circuit is open, which makes loads
+// proceed without the lock.
+func (c *cache) TryLock(ctx context.Context, key string, ttl time.Duration) (unlock func(context.Context) error, ok bool, err error) {
+	locker, ok := c.inner.(ecache.Locker)
+	if !ok {
+		return nil, false, errors.WithStack(ecache.ErrUnsupported)
+	}
+	probe, ok := c.allow()
+	if !ok {
+		return nil, false, errors.WithStack(ErrCircuitOpen)
+	}
+	unlock, ok, err = locker.TryLock(ctx, key, ttl)
+	c.done(ctx, probe, err)
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	return unlock, ok, nil
+}
+
+// IsKeyNotFound checks if error represents missing key in the inner cache,
+// or a read rejected by the open circuit.
+func (c *cache) IsKeyNotFound(err error) bool {
+	return errors.Is(err, ErrCircuitOpen) || c.inner.IsKeyNotFound(err)
+}
+
+// allow reports whether a request may reach the inner cache, and whether
+// it is a probe of the half-open circuit
+func (c *cache) allow() (probe, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state {
+	case Closed:
+		return false, true
+	case Open:
+		if c.now().Sub(c.openedAt) < c.openTimeout {
+			return false, false
+		}
+		c.transition(HalfOpen)
+	}
+	if c.inFlight >= c.probes {
+		return false, false
+	}
+	c.inFlight++
+	return true, true
+}
+
+// done records the outcome of a request let through by allow
+func (c *cache) done(ctx context.Context, probe bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if probe && c.state == HalfOpen {
+		c.inFlight--
+	}
+	if err != nil && ctx.Err() != nil {
+		return // Canceled by the caller, not a sign of failure
+	}
+	failed := err != nil && !c.inner.IsKeyNotFound(err)
+
+	switch {
+	case c.state == HalfOpen && probe:
+		if failed {
+			c.open()
+		} else {
+			c.transition(Closed)
+		}
+	case c.state == Closed:
+		if !failed {
+			c.failures = 0
+		} else if c.failures++; c.failures >= c.threshold {
+			c.open()
+		}
+	}
+}
+
+// open trips the circuit. Must be called with mu held.
+func (c *cache) open() {
+	c.openedAt = c.now()
+	c.transition(Open)
+}
+
+// transition moves to state to, resetting the counters of the state left.
+// Must be called with mu held.
+func (c *cache) transition(to State) {
+	from := c.state
+	if from == to {
+		return
+	}
+	c.state = to
+	c.failures = 0
+	c.inFlight = 0
+	if c.onChange != nil {
+		c.onChange(from, to)
+	}
+}
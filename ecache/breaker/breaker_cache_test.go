@@ -0,0 +1,235 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package breaker
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/voidint/box/ecache"
+	"github.com/voidint/box/ecache/memory"
+)
+
+var errDown = errors.New("connection refused")
+
+// flakyCache fails every request while down
+type flakyCache struct {
+	ecache.Cache
+	down  bool
+	calls int
+}
+
+func (c *flakyCache) Get(ctx context.Context, key string) ([]byte, error) {
+	c.calls++
+	if c.down {
+		return nil, errDown
+	}
+	return c.Cache.Get(ctx, key)
+}
+
+func (c *flakyCache) Set(ctx context.Context, key string, val []byte, expire time.Duration) error {
+	c.calls++
+	if c.down {
+		return errDown
+	}
+	return c.Cache.Set(ctx, key, val, expire)
+}
+
+type user struct {
+	UID uint64
+}
+
+func (u user) ID() uint64 {
+	return u.UID
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	inner := &flakyCache{Cache: memory.NewCache(time.Minute, 0)}
+	now := time.Now()
+	var transitions []string
+	c := NewCache(inner,
+		WithFailureThreshold(2),
+		WithOpenTimeout(time.Second),
+		WithStateChange(func(from, to State) {
+			transitions = append(transitions, from.String()+"->"+to.String())
+		}),
+	)
+	c.now = func() time.Time { return now }
+
+	// Misses are not failures
+	for i := 0; i < 3; i++ {
+		_, err := c.Get(ctx, "user:1")
+		assert.True(t, c.IsKeyNotFound(err))
+	}
+	assert.Equal(t, Closed, c.State())
+
+	// Consecutive failures open the circuit
+	inner.down = true
+	_, err := c.Get(ctx, "user:1")
+	assert.ErrorIs(t, err, errDown)
+	assert.Equal(t, Closed, c.State())
+	assert.ErrorIs(t, c.Set(ctx, "user:1", []byte("v"), 0), errDown)
+	assert.Equal(t, Open, c.State())
+
+	// While open, reads are misses, writes are skipped and deletes fail
+	calls := inner.calls
+	_, err = c.Get(ctx, "user:1")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.True(t, c.IsKeyNotFound(err))
+	assert.Nil(t, c.Set(ctx, "user:1", []byte("v"), 0))
+	vals, err := c.MGet(ctx, "user:1", "user:2")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{nil, nil}, vals)
+	_, err = c.Del(ctx, "user:1")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, calls, inner.calls)
+
+	// A failed probe opens the circuit again
+	now = now.Add(time.Second)
+	assert.Equal(t, HalfOpen, c.State())
+	_, err = c.Get(ctx, "user:1")
+	assert.ErrorIs(t, err, errDown)
+	assert.Equal(t, Open, c.State())
+
+	// A successful probe closes it
+	inner.down = false
+	now = now.Add(time.Second)
+	assert.Nil(t, c.Set(ctx, "user:1", []byte("v"), 0))
+	assert.Equal(t, Closed, c.State())
+	val, err := c.Get(ctx, "user:1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), val)
+
+	assert.Equal(t, []string{
+		"closed->open",
+		"open->half-open", "half-open->open",
+		"open->half-open", "half-open->closed",
+	}, transitions)
+}
+
+func TestEntityFallback(t *testing.T) {
+	ctx := context.Background()
+	inner := &flakyCache{Cache: memory.NewCache(time.Minute, 0), down: true}
+	c := NewCache(inner, WithFailureThreshold(1))
+
+	load := func(ctx context.Context, id uint64) (*user, error) {
+		return &user{UID: id}, nil
+	}
+	// The first lookup trips the circuit, later ones degrade to the loader
+	_, err := ecache.GetEntityByID[user](ctx, c, "user", 1, load)
+	assert.ErrorIs(t, err, errDown)
+	one, err := ecache.GetEntityByID[user](ctx, c, "user", 1, load)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), one.UID)
+
+	// Invalidations fail rather than leave the entry behind silently
+	_, err = ecache.DelCachedEntity(ctx, c, "user:1")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+}
+
+func TestCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	inner := &flakyCache{Cache: memory.NewCache(time.Minute, 0), down: true}
+	c := NewCache(inner, WithFailureThreshold(1))
+
+	_, err := c.Get(ctx, "user:1")
+	assert.ErrorIs(t, err, errDown)
+	assert.Equal(t, Closed, c.State())
+}
+
+type tenantUser struct {
+	UID    uint64
+	Tenant uint64
+}
+
+func (u tenantUser) ID() uint64 {
+	return u.UID
+}
+
+func (u tenantUser) CacheTags() []string {
+	return []string{"tenant:" + strconv.FormatUint(u.Tenant, 10)}
+}
+
+func TestOptionalInterfaces(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Not in effect without the inner cache", func(t *testing.T) {
+		c := NewCache(&flakyCache{Cache: memory.NewCache(time.Minute, 0)})
+		_, ok := ecache.As[ecache.VersionedCache](c)
+		assert.False(t, ok)
+		_, ok = ecache.As[ecache.TaggedCache](c)
+		assert.False(t, ok)
+		_, err := c.Version(ctx, "user:1")
+		assert.ErrorIs(t, err, ecache.ErrUnsupported)
+		_, err = c.PopTag(ctx, "tenant:1")
+		assert.ErrorIs(t, err, ecache.ErrTagsUnsupported)
+	})
+
+	t.Run("Forwarded to the inner cache", func(t *testing.T) {
+		inner := memory.NewCache(time.Minute, 0)
+		c := NewCache(inner)
+		_, ok := ecache.As[ecache.VersionedCache](c)
+		assert.True(t, ok)
+
+		client := ecache.NewClient(c, ecache.WithVersionedWrites(true))
+		repo := ecache.NewRepository[tenantUser, uint64](client, "user")
+		_, err := repo.GetEntityByID(ctx, 1, func(ctx context.Context, id uint64) (*tenantUser, error) {
+			return &tenantUser{UID: id, Tenant: 7}, nil
+		})
+		assert.Nil(t, err)
+
+		affected, err := client.InvalidateTag(ctx, "tenant:7")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), affected)
+		version, err := inner.Version(ctx, "user:1")
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), version)
+	})
+
+	t.Run("Open circuit", func(t *testing.T) {
+		c := NewCache(memory.NewCache(time.Minute, 0))
+		c.mu.Lock()
+		c.open()
+		c.mu.Unlock()
+
+		version, err := c.Version(ctx, "user:1")
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(0), version)
+		ok, err := c.SetIfVersion(ctx, "user:1", version, []byte("v"), 0)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		assert.Nil(t, c.Tag(ctx, "tenant:1", 0, "user:1"))
+
+		_, err = c.Invalidate(ctx, "user:1")
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+		_, err = c.PopTag(ctx, "tenant:1")
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+		_, err = c.TTL(ctx, "user:1")
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+		_, _, err = c.TryLock(ctx, "user:1:lock", time.Second)
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+	})
+}
@@ -0,0 +1,480 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+// KeyBuilder joins key components into a cache key
+type KeyBuilder func(parts ...any) string
+
+// JoinKey returns a KeyBuilder that joins key components with delimiter
+func JoinKey(delimiter rune) KeyBuilder {
+	return func(parts ...any) string {
+		var b strings.Builder
+		for i := range parts {
+			if i > 0 {
+				b.WriteRune(delimiter)
+			}
+			fmt.Fprint(&b, parts[i])
+		}
+		return b.String()
+	}
+}
+
+// WithCodec sets the codec serializing cache values, e.g. GobCodec or an
+// EnvelopeCodec carrying a schema version
+func WithCodec(codec Codec) func(*Client) {
+	return func(c *Client) {
+		c.codec = codec
+	}
+}
+
+// WithExpiration sets the time-to-live for cache entries (<=0 means no expiration)
+func WithExpiration(expiration time.Duration) func(*Client) {
+	return func(c *Client) {
+		c.expiration = expiration
+	}
+}
+
+// WithNegativeCache enables caching of "not found" tombstones for expiration.
+// isNotFound classifies loader errors as "not found" (e.g. sql.ErrNoRows).
+func WithNegativeCache(expiration time.Duration, isNotFound func(err error) bool) func(*Client) {
+	return func(c *Client) {
+		c.negativeExpiration = expiration
+		c.isNotFound = isNotFound
+	}
+}
+
+// WithKeyBuilder sets the function building cache keys from key components
+func WithKeyBuilder(keyBuilder KeyBuilder) func(*Client) {
+	return func(c *Client) {
+		c.keyBuilder = keyBuilder
+	}
+}
+
+// WithDisabled turns off caching when true, every lookup goes to the loader
+func WithDisabled(disabled bool) func(*Client) {
+	return func(c *Client) {
+		c.disabled = disabled
+	}
+}
+
+// WithSingleflightGroup sets the group deduplicating concurrent loads.
+// Clients sharing a group also share in-flight loads for identical keys.
+func WithSingleflightGroup(group *singleflight.Group) func(*Client) {
+	return func(c *Client) {
+		c.group = group
+	}
+}
+
+// WithJitter randomizes every positive TTL written by the entity helpers
+// by up to ±ratio of its value (e.g. 0.1 for ±10%), so entries warmed
+// together do not expire in the same instant. ratio is clamped to [0, 1).
+func WithJitter(ratio float64) func(*Client) {
+	return func(c *Client) {
+		if ratio < 0 {
+			ratio = 0
+		}
+		if ratio >= 1 {
+			ratio = 0.99
+		}
+		c.jitterRatio = ratio
+	}
+}
+
+// WithMaxJitter extends every positive TTL written by the entity helpers
+// by a random duration in [0, spread)
+func WithMaxJitter(spread time.Duration) func(*Client) {
+	return func(c *Client) {
+		c.jitterSpread = spread
+	}
+}
+
+// WithRandSource sets the source of randomness used for jitter.
+// Tests can pass rand.NewSource(seed) to get deterministic TTLs.
+func WithRandSource(src rand.Source) func(*Client) {
+	return func(c *Client) {
+		c.rnd = rand.New(src)
+	}
+}
+
+// WithSoftExpiration enables stale-while-revalidate for entities.
+// Entries carry a soft expiry, after which GetEntityByID still returns the
+// cached value but refreshes it in the background. The cache TTL set by
+// WithExpiration acts as the hard expiry and should be longer than soft.
+func WithSoftExpiration(soft time.Duration) func(*Client) {
+	return func(c *Client) {
+		c.softExpiration = soft
+	}
+}
+
+// WithInvalidationBus broadcasts keys deleted through the client and bumped
+// query tag versions on bus, so other instances can drop them from their
+// in-process caches (see DropOnInvalidation).
+func WithInvalidationBus(bus InvalidationBus) func(*Client) {
+	return func(c *Client) {
+		c.bus = bus
+	}
+}
+
+// WithVersionedWrites guards cache writes with key generations, so a value
+// loaded before DelCachedEntity invalidated its key is not written back.
+// It takes effect only when the cache implements VersionedCache, see As.
+func WithVersionedWrites(versioned bool) func(*Client) {
+	return func(c *Client) {
+		c.versioned = versioned
+	}
+}
+
+// WithSaveInvalidation makes SaveEntity delete the cache entry after
+// persisting instead of writing the saved entity through. Invalidation
+// cannot race with concurrent saves of the same entity, at the cost of
+// one cache miss per save.
+func WithSaveInvalidation(invalidate bool) func(*Client) {
+	return func(c *Client) {
+		c.saveInvalidation = invalidate
+	}
+}
+
+// DefaultLoadTimeout is the default time limit of loads shared through singleflight
+const DefaultLoadTimeout = 30 * time.Second
+
+// WithLoadTimeout sets the time limit of loads shared through singleflight
+// (<=0 means no limit). A shared load runs detached from the cancellation
+// of the caller that started it, so this timeout is what bounds it.
+func WithLoadTimeout(timeout time.Duration) func(*Client) {
+	return func(c *Client) {
+		c.loadTimeout = timeout
+	}
+}
+
+// Client binds a Cache to the settings used by the entity helpers.
+// Unlike the package-level variables, settings are per instance, so
+// subsystems in one binary can use different TTLs or codecs.
+// A Client is safe for concurrent use once constructed.
+type Client struct {
+	cache              Cache
+	codec              Codec
+	expiration         time.Duration
+	negativeExpiration time.Duration
+	isNotFound         func(err error) bool
+	keyBuilder         KeyBuilder
+	disabled           bool
+	group              *singleflight.Group
+	jitterRatio        float64
+	jitterSpread       time.Duration
+	rndMu              sync.Mutex
+	rnd                *rand.Rand
+	softExpiration     time.Duration
+	now                func() time.Time
+	bus                InvalidationBus
+	versioned          bool
+	observers          []Observer
+	loadTimeout        time.Duration
+	saveInvalidation   bool
+	locker             Locker
+	lockWait           time.Duration
+	lockPoll           time.Duration
+	lockFallback       LockFallback
+	queryTagTTL        time.Duration
+}
+
+// NewClient creates a client for cache.
+// Defaults: JSON codec, no expiration, negative caching off,
+// ':' delimited keys, a private singleflight group and DefaultLoadTimeout.
+func NewClient(cache Cache, opts ...func(*Client)) *Client {
+	c := Client{
+		cache:       cache,
+		codec:       JSONCodec,
+		keyBuilder:  JoinKey(':'),
+		group:       new(singleflight.Group),
+		now:         time.Now,
+		loadTimeout: DefaultLoadTimeout,
+		lockWait:    DefaultLockWait,
+		lockPoll:    DefaultLockPollInterval,
+		queryTagTTL: DefaultQueryTagTTL,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return &c
+}
+
+// newDefaultClient creates the client backing the package-level functions
+// from the current values of the package-level variables
+func newDefaultClient(cache Cache) *Client {
+	return &Client{
+		cache:              cache,
+		codec:              funcCodec{marshal: Marshal, unmarshal: Unmarshal},
+		expiration:         DefaultExpiration,
+		negativeExpiration: NegativeExpiration,
+		isNotFound:         IsNotFound,
+		keyBuilder:         JoinKey(Delimiter),
+		disabled:           Disabled,
+		group:              &singleFlightGroup,
+		now:                time.Now,
+		loadTimeout:        DefaultLoadTimeout,
+		queryTagTTL:        DefaultQueryTagTTL,
+	}
+}
+
+// Cache returns the underlying cache
+func (c *Client) Cache() Cache {
+	return c.cache
+}
+
+// Key builds a cache key from key components with the client's KeyBuilder
+func (c *Client) Key(parts ...any) string {
+	return c.keyBuilder(parts...)
+}
+
+// DelCachedEntity deletes cached data for specified key.
+// With versioned writes, the key generation is bumped as well.
+// With an invalidation bus configured, the key is also broadcast to
+// other instances.
+func (c *Client) DelCachedEntity(ctx context.Context, key string) (affected int64, err error) {
+	return c.del(ctx, key)
+}
+
+// del deletes keys in one call, bumping their generations with versioned
+// writes and broadcasting them with an invalidation bus
+func (c *Client) del(ctx context.Context, keys ...string) (affected int64, err error) {
+	if c.disabled || len(keys) == 0 {
+		return 0, nil
+	}
+
+	if vc := c.versionedCache(); vc != nil {
+		affected, err = vc.Invalidate(ctx, keys...)
+	} else {
+		affected, err = c.cache.Del(ctx, keys...)
+	}
+	if err != nil {
+		return affected, errors.WithStack(err)
+	}
+	if c.bus != nil {
+		if err = c.bus.Publish(ctx, keys...); err != nil {
+			return affected, errors.WithStack(err)
+		}
+	}
+	return affected, nil
+}
+
+// uniqueKey builds the cache key of a unique key entry. Structs and
+// CompositeUniqueKey values are encoded with EncodeUniqueKey.
+func (c *Client) uniqueKey(ukKeyPrefix string, ukVal any) (string, error) {
+	if _, ok := ukVal.(CompositeUniqueKey); !ok && reflect.Indirect(reflect.ValueOf(ukVal)).Kind() != reflect.Struct {
+		return c.Key(ukKeyPrefix, ukVal), nil
+	}
+	parts, err := EncodeUniqueKey(ukVal)
+	if err != nil {
+		return "", err
+	}
+	return c.Key(append([]any{ukKeyPrefix}, parts...)...), nil
+}
+
+// ttl applies the configured jitter to expiration.
+// Non-positive expirations keep their special meaning and are returned as is.
+func (c *Client) ttl(expiration time.Duration) time.Duration {
+	if expiration <= 0 || (c.jitterRatio <= 0 && c.jitterSpread <= 0) {
+		return expiration
+	}
+
+	jittered := expiration
+	if c.jitterRatio > 0 {
+		jittered += time.Duration((2*c.float64() - 1) * c.jitterRatio * float64(expiration))
+	}
+	if c.jitterSpread > 0 {
+		jittered += time.Duration(c.float64() * float64(c.jitterSpread))
+	}
+	if jittered <= 0 {
+		return expiration
+	}
+	return jittered
+}
+
+// float64 returns a pseudo-random number in [0.0, 1.0)
+func (c *Client) float64() float64 {
+	if c.rnd == nil {
+		return rand.Float64()
+	}
+	c.rndMu.Lock()
+	defer c.rndMu.Unlock()
+	return c.rnd.Float64()
+}
+
+// softEntryMagic prefixes entries that carry a soft expiry.
+// The leading NUL byte keeps it from colliding with serialized entities.
+var softEntryMagic = []byte("\x00swr")
+
+// wrapEntry prepends the soft expiry to serialized entity data.
+// Data is returned as is when soft expiration is disabled.
+//
+// Layout: magic | soft expiry as big-endian Unix nanoseconds (8 bytes) | data
+func (c *Client) wrapEntry(data []byte) []byte {
+	if c.softExpiration <= 0 {
+		return data
+	}
+	entry := make([]byte, 0, len(softEntryMagic)+8+len(data))
+	entry = append(entry, softEntryMagic...)
+	entry = binary.BigEndian.AppendUint64(entry, uint64(c.now().Add(c.softExpiration).UnixNano()))
+	return append(entry, data...)
+}
+
+// unwrapEntry extracts serialized entity data and reports whether its soft
+// expiry has passed. Entries without soft expiry are never stale.
+func (c *Client) unwrapEntry(entry []byte) (data []byte, stale bool) {
+	if len(entry) < len(softEntryMagic)+8 || !bytes.HasPrefix(entry, softEntryMagic) {
+		return entry, false
+	}
+	softExpiry := int64(binary.BigEndian.Uint64(entry[len(softEntryMagic):]))
+	return entry[len(softEntryMagic)+8:], c.now().UnixNano() > softExpiry
+}
+
+// doChan starts fn under key unless a call for key is already in flight,
+// and returns the channel delivering its result. fn runs with a context
+// detached from the cancellation of ctx and bounded by the load timeout,
+// so one caller giving up does not fail the callers sharing the load.
+func (c *Client) doChan(ctx context.Context, key string, fn func(context.Context) (any, error)) <-chan singleflight.Result {
+	detached := context.WithoutCancel(ctx)
+	return c.group.DoChan(key, func() (any, error) {
+		loadCtx := detached
+		if c.loadTimeout > 0 {
+			var cancel context.CancelFunc
+			loadCtx, cancel = context.WithTimeout(detached, c.loadTimeout)
+			defer cancel()
+		}
+		return fn(loadCtx)
+	})
+}
+
+// do is the blocking form of doChan. It returns early with the error of
+// ctx when ctx is done, leaving the shared load running for other callers.
+func (c *Client) do(ctx context.Context, key string, fn func(context.Context) (any, error)) (any, error) {
+	select {
+	case res := <-c.doChan(ctx, key, fn):
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return nil, errors.WithStack(ctx.Err())
+	}
+}
+
+// versionedCache returns the cache as VersionedCache when versioned writes
+// are enabled and supported, otherwise nil
+func (c *Client) versionedCache() VersionedCache {
+	if !c.versioned {
+		return nil
+	}
+	vc, _ := As[VersionedCache](c.cache)
+	return vc
+}
+
+// version reads the generation of key when versioned writes are in effect
+func (c *Client) version(ctx context.Context, key string) (version uint64, err error) {
+	vc := c.versionedCache()
+	if vc == nil {
+		return 0, nil
+	}
+	if version, err = vc.Version(ctx, key); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return version, nil
+}
+
+// set stores val in cache. When versioned writes are in effect, the write
+// is discarded if key was invalidated after version was read.
+func (c *Client) set(ctx context.Context, key string, version uint64, val []byte, expire time.Duration) (err error) {
+	if vc := c.versionedCache(); vc != nil {
+		_, err = vc.SetIfVersion(ctx, key, version, val, expire)
+	} else {
+		err = c.cache.Set(ctx, key, val, expire)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// mset stores items in cache in one batch. When versioned writes are in
+// effect, every item is written separately against its version in versions.
+func (c *Client) mset(ctx context.Context, items map[string][]byte, versions map[string]uint64, expire time.Duration) (err error) {
+	if len(items) == 0 {
+		return nil
+	}
+	if c.versionedCache() == nil {
+		if err = c.cache.MSet(ctx, items, expire); err != nil {
+			return errors.WithStack(err)
+		}
+		return nil
+	}
+	for key, val := range items {
+		if err = c.set(ctx, key, versions[key], val, expire); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) onHit(ctx context.Context, prefix, key string) {
+	for _, obs := range c.observers {
+		obs.OnHit(ctx, prefix, key)
+	}
+}
+
+func (c *Client) onMiss(ctx context.Context, prefix, key string) {
+	for _, obs := range c.observers {
+		obs.OnMiss(ctx, prefix, key)
+	}
+}
+
+func (c *Client) onLoad(ctx context.Context, prefix string, duration time.Duration, err error) {
+	for _, obs := range c.observers {
+		obs.OnLoad(ctx, prefix, duration, err)
+	}
+}
+
+func (c *Client) onSetError(ctx context.Context, prefix, key string, err error) {
+	for _, obs := range c.observers {
+		obs.OnSetError(ctx, prefix, key, err)
+	}
+}
+
+func (c *Client) onDecodeError(ctx context.Context, prefix, key string, err error) {
+	for _, obs := range c.observers {
+		obs.OnDecodeError(ctx, prefix, key, err)
+	}
+}
+
+// negativeCacheEnabled reports whether "not found" results should be cached
+func (c *Client) negativeCacheEnabled() bool {
+	return c.negativeExpiration > 0 && c.isNotFound != nil
+}
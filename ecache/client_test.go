@@ -0,0 +1,214 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinKey(t *testing.T) {
+	assert.Equal(t, "user:1", JoinKey(':')("user", uint64(1)))
+	assert.Equal(t, "user|items|2", JoinKey('|')("user", "items", uint8(2)))
+	assert.Equal(t, "", JoinKey(':')())
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	load := func(ctx context.Context, id uint64) (*user, error) {
+		return &user{UID: id, Name: "foo"}, nil
+	}
+
+	t.Run("Per-client settings", func(t *testing.T) {
+		cache := newMapCache()
+		var encoded int
+		a := NewRepository[user, uint64](NewClient(cache, WithExpiration(time.Minute)), "a")
+		b := NewRepository[user, uint64](NewClient(cache,
+			WithExpiration(time.Hour),
+			WithKeyBuilder(JoinKey('/')),
+			WithCodec(funcCodec{
+				marshal: func(v any) ([]byte, error) {
+					encoded++
+					return json.Marshal(v)
+				},
+				unmarshal: json.Unmarshal,
+			}),
+		), "b")
+
+		_, err := a.GetEntityByID(ctx, 1, load)
+		assert.Nil(t, err)
+		_, err = b.GetEntityByID(ctx, 1, load)
+		assert.Nil(t, err)
+
+		assert.Equal(t, time.Minute, cache.expires["a:1"])
+		assert.Equal(t, time.Hour, cache.expires["b/1"])
+		assert.Equal(t, 1, encoded)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		cache := newMapCache()
+		c := NewClient(cache, WithDisabled(true))
+		one, err := NewRepository[user, uint64](c, "user").GetEntityByID(ctx, 1, load)
+		assert.Nil(t, err)
+		assert.Equal(t, &user{UID: 1, Name: "foo"}, one)
+		assert.Equal(t, 0, len(cache.items))
+
+		affected, err := c.DelCachedEntity(ctx, "user:1")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), affected)
+	})
+
+	t.Run("GetEntityByUniqueKey", func(t *testing.T) {
+		cache := newMapCache()
+		repo := NewRepository[user, uint64](NewClient(cache), "user")
+
+		var calls int
+		getIDByName := func(ctx context.Context) (uint64, error) {
+			calls++
+			return 7, nil
+		}
+		for i := 0; i < 2; i++ {
+			one, err := repo.GetEntityByUniqueKey(ctx, "user:name", "foo", getIDByName, load)
+			assert.Nil(t, err)
+			assert.Equal(t, &user{UID: 7, Name: "foo"}, one)
+		}
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, uint64(7), cache.items["user:name:foo"])
+
+		affected, err := repo.DelCachedEntity(ctx, 7)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), affected)
+	})
+}
+
+func TestClientTTL(t *testing.T) {
+	t.Run("No jitter", func(t *testing.T) {
+		c := NewClient(newMapCache())
+		assert.Equal(t, time.Minute, c.ttl(time.Minute))
+	})
+
+	t.Run("Ratio", func(t *testing.T) {
+		c := NewClient(newMapCache(), WithJitter(0.1), WithRandSource(rand.NewSource(1)))
+		ttls := make(map[time.Duration]struct{})
+		for i := 0; i < 100; i++ {
+			ttl := c.ttl(time.Minute)
+			assert.True(t, ttl >= 54*time.Second && ttl <= 66*time.Second)
+			ttls[ttl] = struct{}{}
+		}
+		assert.True(t, len(ttls) > 1)
+	})
+
+	t.Run("Max spread", func(t *testing.T) {
+		c := NewClient(newMapCache(), WithMaxJitter(time.Second))
+		for i := 0; i < 100; i++ {
+			ttl := c.ttl(time.Minute)
+			assert.True(t, ttl >= time.Minute && ttl < time.Minute+time.Second)
+		}
+	})
+
+	t.Run("Deterministic seed", func(t *testing.T) {
+		a := NewClient(newMapCache(), WithJitter(0.5), WithRandSource(rand.NewSource(42)))
+		b := NewClient(newMapCache(), WithJitter(0.5), WithRandSource(rand.NewSource(42)))
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, a.ttl(time.Hour), b.ttl(time.Hour))
+		}
+	})
+
+	t.Run("Non-positive expiration is preserved", func(t *testing.T) {
+		c := NewClient(newMapCache(), WithJitter(0.5), WithMaxJitter(time.Second))
+		assert.Equal(t, time.Duration(0), c.ttl(0))
+		assert.Equal(t, time.Duration(-1), c.ttl(-1))
+	})
+}
+
+func TestSoftExpiration(t *testing.T) {
+	ctx := context.Background()
+	cache := newMapCache()
+	c := NewClient(cache, WithExpiration(time.Hour), WithSoftExpiration(time.Minute))
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	repo := NewRepository[user, uint64](c, "user")
+
+	loaded := make(chan struct{}, 2)
+	var version int
+	load := func(ctx context.Context, id uint64) (*user, error) {
+		version++
+		defer func() { loaded <- struct{}{} }()
+		return &user{UID: id, Name: fmt.Sprintf("v%d", version)}, nil
+	}
+
+	one, err := repo.GetEntityByID(ctx, 1, load)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", one.Name)
+	<-loaded
+
+	t.Run("Fresh value", func(t *testing.T) {
+		one, err := repo.GetEntityByID(ctx, 1, load)
+		assert.Nil(t, err)
+		assert.Equal(t, "v1", one.Name)
+		assert.Equal(t, 0, len(loaded))
+	})
+
+	t.Run("Stale value is served and refreshed in the background", func(t *testing.T) {
+		now = now.Add(2 * time.Minute)
+
+		one, err := repo.GetEntityByID(ctx, 1, load)
+		assert.Nil(t, err)
+		assert.Equal(t, "v1", one.Name)
+
+		select {
+		case <-loaded:
+		case <-time.After(time.Second):
+			t.Fatal("background refresh did not run")
+		}
+		assert.Eventually(t, func() bool {
+			one, err := repo.GetEntityByID(ctx, 1, load)
+			return err == nil && one.Name == "v2"
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("Batch lookup reloads stale values", func(t *testing.T) {
+		now = now.Add(2 * time.Minute)
+
+		items, err := repo.GetEntitiesByIDs(ctx, []uint64{1}, func(ctx context.Context, ids []uint64) (map[uint64]*user, error) {
+			return map[uint64]*user{1: {UID: 1, Name: "batch"}}, nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []*user{{UID: 1, Name: "batch"}}, items)
+	})
+}
+
+func TestUnwrapEntry(t *testing.T) {
+	c := NewClient(newMapCache())
+	data, stale := c.unwrapEntry([]byte(`{"id":1}`))
+	assert.Equal(t, []byte(`{"id":1}`), data)
+	assert.False(t, stale)
+
+	c = NewClient(newMapCache(), WithSoftExpiration(time.Minute))
+	data, stale = c.unwrapEntry(c.wrapEntry([]byte(`{"id":1}`)))
+	assert.Equal(t, []byte(`{"id":1}`), data)
+	assert.False(t, stale)
+}
@@ -0,0 +1,254 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrSchemaMismatch indicates cached data written with another schema version.
+	// The entity helpers treat it like any decode error, i.e. as a cache miss.
+	ErrSchemaMismatch = errors.New("schema version mismatch")
+
+	// ErrMalformedEnvelope indicates cached data that is not a valid envelope
+	ErrMalformedEnvelope = errors.New("malformed envelope")
+)
+
+// Codec serializes cache values
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	// JSONCodec serializes cache values with encoding/json
+	JSONCodec Codec = jsonCodec{}
+
+	// GobCodec serializes cache values with encoding/gob
+	GobCodec Codec = gobCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(v); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// funcCodec adapts a pair of serialization functions to Codec
+type funcCodec struct {
+	marshal   func(v any) ([]byte, error)
+	unmarshal func(data []byte, v any) error
+}
+
+func (fc funcCodec) Marshal(v any) ([]byte, error) {
+	return fc.marshal(v)
+}
+
+func (fc funcCodec) Unmarshal(data []byte, v any) error {
+	return fc.unmarshal(data, v)
+}
+
+// Compression identifies the compression algorithm of an envelope payload
+type Compression byte
+
+const (
+	// NoCompression stores payloads as is
+	NoCompression Compression = iota
+	// Gzip compresses payloads with compress/gzip
+	Gzip
+	// Deflate compresses payloads with compress/flate
+	Deflate
+)
+
+// WithSchemaVersion sets the schema version stamped on every envelope.
+// Bump it whenever the cached struct changes incompatibly.
+func WithSchemaVersion(version uint32) func(*EnvelopeCodec) {
+	return func(ec *EnvelopeCodec) {
+		ec.version = version
+	}
+}
+
+// WithCompression compresses payloads of at least threshold bytes with compression
+func WithCompression(compression Compression, threshold int) func(*EnvelopeCodec) {
+	return func(ec *EnvelopeCodec) {
+		ec.compression = compression
+		ec.threshold = threshold
+	}
+}
+
+// envelopeMagic prefixes every envelope.
+// The leading NUL byte keeps it from colliding with other serialized data.
+var envelopeMagic = []byte("\x00env")
+
+// envelopeHeaderSize is the size of magic, version, compression and length
+var envelopeHeaderSize = len(envelopeMagic) + 4 + 1 + 4
+
+// EnvelopeCodec wraps the output of another codec in a length-prefixed
+// envelope carrying a schema version and optional compression.
+// Data with another schema version fails to decode with ErrSchemaMismatch.
+//
+// Layout: magic | version (uint32) | compression (byte) | length (uint32) | payload
+// Integers are big-endian, length is the size of the (compressed) payload.
+type EnvelopeCodec struct {
+	inner       Codec
+	version     uint32
+	compression Compression
+	threshold   int
+}
+
+// NewEnvelopeCodec creates an envelope codec around inner
+func NewEnvelopeCodec(inner Codec, opts ...func(*EnvelopeCodec)) *EnvelopeCodec {
+	ec := EnvelopeCodec{
+		inner: inner,
+	}
+	for _, opt := range opts {
+		opt(&ec)
+	}
+	return &ec
+}
+
+// Marshal serializes v with the inner codec and wraps it in an envelope
+func (ec *EnvelopeCodec) Marshal(v any) ([]byte, error) {
+	payload, err := ec.inner.Marshal(v)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	compression := NoCompression
+	if ec.compression != NoCompression && len(payload) >= ec.threshold {
+		if payload, err = compress(ec.compression, payload); err != nil {
+			return nil, err
+		}
+		compression = ec.compression
+	}
+
+	data := make([]byte, 0, envelopeHeaderSize+len(payload))
+	data = append(data, envelopeMagic...)
+	data = binary.BigEndian.AppendUint32(data, ec.version)
+	data = append(data, byte(compression))
+	data = binary.BigEndian.AppendUint32(data, uint32(len(payload)))
+	return append(data, payload...), nil
+}
+
+// Unmarshal unwraps the envelope and deserializes its payload into v
+func (ec *EnvelopeCodec) Unmarshal(data []byte, v any) error {
+	if len(data) < envelopeHeaderSize || !bytes.HasPrefix(data, envelopeMagic) {
+		return errors.WithStack(ErrMalformedEnvelope)
+	}
+	header := data[len(envelopeMagic):]
+	if version := binary.BigEndian.Uint32(header); version != ec.version {
+		return errors.Wrapf(ErrSchemaMismatch, "got %d, want %d", version, ec.version)
+	}
+	compression := Compression(header[4])
+	payload := data[envelopeHeaderSize:]
+	if length := binary.BigEndian.Uint32(header[5:]); int64(length) != int64(len(payload)) {
+		return errors.WithStack(ErrMalformedEnvelope)
+	}
+
+	payload, err := decompress(compression, payload)
+	if err != nil {
+		return err
+	}
+	if err = ec.inner.Unmarshal(payload, v); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// compress compresses payload with compression
+func compress(compression Compression, payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch compression {
+	case Gzip:
+		w = gzip.NewWriter(&buf)
+	case Deflate:
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		w = fw
+	default:
+		return nil, errors.Errorf("unknown compression %d", compression)
+	}
+	if _, err := w.Write(payload); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress reverses compress
+func decompress(compression Compression, payload []byte) ([]byte, error) {
+	var r io.ReadCloser
+	switch compression {
+	case NoCompression:
+		return payload, nil
+	case Gzip:
+		gr, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		r = gr
+	case Deflate:
+		r = flate.NewReader(bytes.NewReader(payload))
+	default:
+		return nil, errors.Wrapf(ErrMalformedEnvelope, "unknown compression %d", compression)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return data, nil
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodecs(t *testing.T) {
+	big := user{UID: 1, Name: string(bytes.Repeat([]byte("foo"), 100))}
+
+	for name, codec := range map[string]Codec{
+		"JSON":             JSONCodec,
+		"Gob":              GobCodec,
+		"Envelope":         NewEnvelopeCodec(JSONCodec, WithSchemaVersion(3)),
+		"Envelope gzip":    NewEnvelopeCodec(GobCodec, WithCompression(Gzip, 64)),
+		"Envelope deflate": NewEnvelopeCodec(JSONCodec, WithCompression(Deflate, 64)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			for _, in := range []user{{UID: 1, Name: "foo"}, big} {
+				data, err := codec.Marshal(&in)
+				assert.Nil(t, err)
+				var out user
+				assert.Nil(t, codec.Unmarshal(data, &out))
+				assert.Equal(t, in, out)
+			}
+		})
+	}
+}
+
+func TestEnvelopeCodec(t *testing.T) {
+	big := user{UID: 1, Name: string(bytes.Repeat([]byte("foo"), 100))}
+
+	t.Run("Compression above threshold", func(t *testing.T) {
+		plain, err := NewEnvelopeCodec(JSONCodec).Marshal(&big)
+		assert.Nil(t, err)
+		compressed, err := NewEnvelopeCodec(JSONCodec, WithCompression(Gzip, 64)).Marshal(&big)
+		assert.Nil(t, err)
+		assert.True(t, len(compressed) < len(plain))
+
+		small, err := NewEnvelopeCodec(JSONCodec, WithCompression(Gzip, 1024)).Marshal(&big)
+		assert.Nil(t, err)
+		assert.Equal(t, plain, small)
+	})
+
+	t.Run("Schema mismatch", func(t *testing.T) {
+		data, err := NewEnvelopeCodec(JSONCodec, WithSchemaVersion(1)).Marshal(&big)
+		assert.Nil(t, err)
+		var out user
+		assert.ErrorIs(t, NewEnvelopeCodec(JSONCodec, WithSchemaVersion(2)).Unmarshal(data, &out), ErrSchemaMismatch)
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		codec := NewEnvelopeCodec(JSONCodec)
+		data, err := codec.Marshal(&big)
+		assert.Nil(t, err)
+		var out user
+		for _, malformed := range [][]byte{nil, []byte(`{"id":1}`), data[:len(data)-1]} {
+			assert.ErrorIs(t, codec.Unmarshal(malformed, &out), ErrMalformedEnvelope)
+		}
+	})
+
+	t.Run("Bumped schema version is a cache miss", func(t *testing.T) {
+		ctx := context.Background()
+		cache := newMapCache()
+		var calls int
+		load := func(ctx context.Context, id uint64) (*user, error) {
+			calls++
+			return &user{UID: id}, nil
+		}
+
+		v1 := NewRepository[user, uint64](NewClient(cache, WithCodec(NewEnvelopeCodec(JSONCodec, WithSchemaVersion(1)))), "user")
+		v2 := NewRepository[user, uint64](NewClient(cache, WithCodec(NewEnvelopeCodec(JSONCodec, WithSchemaVersion(2)))), "user")
+		for _, repo := range []*Repository[user, uint64]{v1, v2, v2} {
+			one, err := repo.GetEntityByID(ctx, 1, load)
+			assert.Nil(t, err)
+			assert.Equal(t, &user{UID: 1}, one)
+		}
+		assert.Equal(t, 2, calls)
+	})
+}
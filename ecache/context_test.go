@@ -0,0 +1,84 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharedLoadCancellation(t *testing.T) {
+	cache := newMapCache()
+	repo := NewRepository[user, uint64](NewClient(cache, WithLoadTimeout(time.Second)), "user")
+
+	var once sync.Once
+	started, release := make(chan struct{}), make(chan struct{})
+	load := func(ctx context.Context, id uint64) (*user, error) {
+		once.Do(func() { close(started) })
+		select {
+		case <-release:
+			return &user{UID: id}, ctx.Err()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// The first caller starts the shared load, then gives up
+	ctx0, cancel0 := context.WithCancel(context.Background())
+	errs0 := make(chan error, 1)
+	go func() {
+		_, err := repo.GetEntityByID(ctx0, 1, load)
+		errs0 <- err
+	}()
+	<-started
+
+	// The second caller waits for the same load
+	type result struct {
+		one *user
+		err error
+	}
+	results1 := make(chan result, 1)
+	go func() {
+		one, err := repo.GetEntityByID(context.Background(), 1, load)
+		results1 <- result{one, err}
+	}()
+
+	cancel0()
+	assert.ErrorIs(t, <-errs0, context.Canceled)
+
+	close(release)
+	res := <-results1
+	assert.Nil(t, res.err)
+	assert.Equal(t, &user{UID: 1}, res.one)
+	assert.Contains(t, cache.items, "user:1")
+}
+
+func TestLoadTimeout(t *testing.T) {
+	repo := NewRepository[user, uint64](NewClient(newMapCache(), WithLoadTimeout(time.Millisecond)), "user")
+	_, err := repo.GetEntityByID(context.Background(), 1, func(ctx context.Context, id uint64) (*user, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
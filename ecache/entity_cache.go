@@ -20,9 +20,9 @@
 package ecache
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
 	"time"
 
 	"github.com/pkg/errors"
@@ -30,6 +30,9 @@ import (
 	"golang.org/x/sync/singleflight"
 )
 
+// The variables below configure the package-level functions, which are
+// thin wrappers over a Client built from their current values.
+// Prefer NewClient with options, which keeps settings per instance.
 var (
 	singleFlightGroup singleflight.Group
 
@@ -47,8 +50,31 @@ var (
 
 	// Delimiter separates components in cache key strings
 	Delimiter = ':'
+
+	// NegativeExpiration defines the time-to-live for "not found" tombstones.
+	// Negative caching is enabled only when it is positive and IsNotFound is set.
+	NegativeExpiration time.Duration = 0 // disabled
+
+	// IsNotFound classifies loader errors as "not found" (e.g. sql.ErrNoRows)
+	IsNotFound func(err error) bool
 )
 
+// ErrEntityNotFound indicates the entity is known to be absent, either from
+// a cached tombstone or from a loader error classified by IsNotFound
+var ErrEntityNotFound = errors.New("entity not found")
+
+// ErrTagsUnsupported indicates the cache does not implement TaggedCache
+var ErrTagsUnsupported = errors.New("cache does not support tags")
+
+// tombstone marks a cached "not found" entity.
+// The leading NUL byte keeps it from colliding with serialized entities.
+var tombstone = []byte("\x00ecache:tombstone")
+
+// isTombstone reports whether cached data is a "not found" marker
+func isTombstone(data []byte) bool {
+	return bytes.Equal(data, tombstone)
+}
+
 // Cache defines the contract for cache implementations.
 // Implementations must handle:
 // - Serialization/deserialization using Marshal/Unmarshal functions
@@ -115,6 +141,26 @@ type Cache interface {
 	// Returns:
 	//   error: Storage errors, nil on success
 	SetUint64(ctx context.Context, key string, val uint64, expire time.Duration) error
+	// MGet retrieves multiple raw byte slices from cache in one round trip.
+	//
+	// Args:
+	//   ctx: Context for request cancellation/timeout
+	//   keys: Cache entry identifiers
+	//
+	// Returns:
+	//   vals: Cached byte slices aligned with keys (nil element on cache miss)
+	//   err: Storage errors, nil on success. Cache misses are not errors
+	MGet(ctx context.Context, keys ...string) (vals [][]byte, err error)
+	// MSet stores multiple byte slices in cache with the same expiration.
+	//
+	// Args:
+	//   ctx: Context for request cancellation/timeout
+	//   items: Cache entry identifiers mapped to data to store
+	//   expire: TTL duration (<=0 means no expiration)
+	//
+	// Returns:
+	//   error: Storage errors, nil on success
+	MSet(ctx context.Context, items map[string][]byte, expire time.Duration) error
 	// IsKeyNotFound checks if error represents cache miss (key not exists).
 	//
 	// Implementation should return true for:
@@ -125,6 +171,95 @@ type Cache interface {
 	IsKeyNotFound(err error) bool
 }
 
+// VersionedCache is implemented by caches supporting version-stamped writes.
+// Every key has a generation, bumped whenever the key is invalidated.
+// A loader reads the generation before querying the database and writes
+// with SetIfVersion, so a write racing with an invalidation is discarded
+// instead of re-inserting stale data.
+type VersionedCache interface {
+	Cache
+	// Version retrieves the current generation of key.
+	//
+	// Args:
+	//   ctx: Context for request cancellation/timeout
+	//   key: Cache entry identifier
+	//
+	// Returns:
+	//   version: Current generation (0 if never invalidated)
+	//   err: Storage errors, nil on success
+	Version(ctx context.Context, key string) (version uint64, err error)
+	// SetIfVersion atomically stores byte slice in cache with expiration
+	// if the generation of key still equals version.
+	//
+	// Args:
+	//   ctx: Context for request cancellation/timeout
+	//   key: Cache entry identifier
+	//   version: Generation read by Version before loading val
+	//   val: Data to store
+	//   expire: TTL duration (<=0 means no expiration)
+	//
+	// Returns:
+	//   ok: False if the write was discarded because key was invalidated
+	//   err: Storage errors, nil on success
+	SetIfVersion(ctx context.Context, key string, version uint64, val []byte, expire time.Duration) (ok bool, err error)
+	// Invalidate atomically deletes entries and bumps their generations.
+	//
+	// Args:
+	//   ctx: Context for request cancellation/timeout
+	//   keys: Cache keys to invalidate
+	//
+	// Returns:
+	//   affected: Number of successfully deleted entries
+	//   err: Storage errors, nil on success
+	Invalidate(ctx context.Context, keys ...string) (affected int64, err error)
+}
+
+// TaggedCache is implemented by caches maintaining a tag index, which
+// groups entries written under a tag so they can be deleted together.
+// See Client.InvalidateTag.
+type TaggedCache interface {
+	Cache
+	// Tag adds keys to the index of tag.
+	//
+	// Args:
+	//   ctx: Context for request cancellation/timeout
+	//   tag: Tag index identifier
+	//   expire: TTL of the tagged entries, the index outlives the longest one
+	//   keys: Cache keys to add
+	//
+	// Returns:
+	//   error: Storage errors, nil on success
+	Tag(ctx context.Context, tag string, expire time.Duration, keys ...string) error
+	// PopTag atomically retrieves and removes the index of tag.
+	//
+	// Args:
+	//   ctx: Context for request cancellation/timeout
+	//   tag: Tag index identifier
+	//
+	// Returns:
+	//   keys: Cache keys added since the last PopTag, possibly expired
+	//   err: Storage errors, nil on success. Unknown tags are not errors
+	PopTag(ctx context.Context, tag string) (keys []string, err error)
+}
+
+// ExpiringCache is implemented by caches reporting the remaining TTL of
+// entries, so entries copied to another cache do not outlive the source.
+// See ecache/tiered.
+type ExpiringCache interface {
+	Cache
+	// TTL retrieves the remaining time-to-live of entries.
+	//
+	// Args:
+	//   ctx: Context for request cancellation/timeout
+	//   keys: Cache entry identifiers
+	//
+	// Returns:
+	//   ttls: Remaining TTLs aligned with keys, 0 for entries without
+	//         expiration and for missing keys
+	//   err: Storage errors, nil on success
+	TTL(ctx context.Context, keys ...string) (ttls []time.Duration, err error)
+}
+
 // CacheableEntity defines the contract for cacheable domain entities
 // Used to enforce ID-based caching constraints
 // Implementations should:
@@ -134,25 +269,50 @@ type CacheableEntity[INT constraints.Unsigned] interface {
 	ID() INT
 }
 
+// TaggedEntity is implemented by entities whose cache entries are grouped
+// under tags, e.g. "tenant:42". Entries written by the entity helpers are
+// then deleted by InvalidateTag with any of the tags.
+type TaggedEntity interface {
+	CacheTags() []string
+}
+
 // DelCachedEntity deletes cached data for specified key
 func DelCachedEntity(ctx context.Context, cache Cache, key string) (affected int64, err error) {
-	if Disabled {
-		return 0, nil
-	}
-
-	if affected, err = cache.Del(ctx, key); err != nil {
-		return affected, errors.WithStack(err)
-	}
-	return affected, nil
+	return newDefaultClient(cache).DelCachedEntity(ctx, key)
 }
 
-// GetEntityByID implements a dual-check mechanism:
-// 1. Check cache first with singleflight deduplication
-// 2. Fallback to database on cache miss
-// 3. Repopulate cache with database result
-//
-// The cache-aside pattern prevents stale cache returns while
-// singleflight prevents cache stampede
+// InvalidateEntity deletes every cache entry related to the entity with id
+// in one cache call. See Repository.InvalidateEntity for details.
+func InvalidateEntity[INT constraints.Unsigned](
+	ctx context.Context,
+	cache Cache,
+	entityKeyPrefix string,
+	id INT,
+	uniqueKeys ...UniqueKeyRef,
+) (affected int64, err error) {
+	return invalidateEntity(ctx, newDefaultClient(cache), entityKeyPrefix, id, uniqueKeys...)
+}
+
+// InvalidateTag deletes every cache entry written under tag.
+// See Client.InvalidateTag for details.
+func InvalidateTag(ctx context.Context, cache Cache, tag string) (affected int64, err error) {
+	return newDefaultClient(cache).InvalidateTag(ctx, tag)
+}
+
+// SaveEntity persists entity and writes it through to the cache.
+// See Repository.SaveEntity for details.
+func SaveEntity[T CacheableEntity[INT], INT constraints.Unsigned](
+	ctx context.Context,
+	cache Cache,
+	entityKeyPrefix string,
+	entity *T,
+	persist func(context.Context, *T) error,
+) error {
+	return NewRepository[T, INT](newDefaultClient(cache), entityKeyPrefix).SaveEntity(ctx, entity, persist)
+}
+
+// GetEntityByID retrieves an entity with cache-aside pattern.
+// See Repository.GetEntityByID for details.
 func GetEntityByID[T CacheableEntity[INT], INT constraints.Unsigned](
 	ctx context.Context,
 	cache Cache,
@@ -160,57 +320,11 @@ func GetEntityByID[T CacheableEntity[INT], INT constraints.Unsigned](
 	id INT,
 	getEntityByID func(context.Context, INT) (*T, error),
 ) (*T, error) {
-	// 0. When cache is disabled, directly query database
-	if Disabled {
-		one, err := getEntityByID(ctx, id)
-		if err != nil {
-			return nil, errors.WithStack(err)
-		}
-		return one, nil
-	}
-
-	// 1. First attempt to retrieve object from cache
-	key := fmt.Sprintf("%s%c%d", entityKeyPrefix, Delimiter, id)
-
-	data, err := cache.Get(ctx, key)
-	if err != nil && !cache.IsKeyNotFound(err) {
-		return nil, errors.WithStack(err)
-	}
-
-	if err == nil {
-		// 2. If value exists, attempt deserialization and return object
-		var one T
-		if err = Unmarshal(data, &one); err == nil {
-			return &one, nil
-		}
-		// If deserialization fails, continue execution flow
-	}
-
-	// 2. Query database for target ID
-	entity, err, _ := singleFlightGroup.Do(key, func() (any, error) { // Prevent cache breakdown
-		return getEntityByID(ctx, id)
-	})
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-
-	// 3. Serialize object and store in cache
-	if data, err = Marshal(entity); err != nil {
-		return nil, errors.WithStack(err)
-	}
-	if err = cache.Set(ctx, key, data, DefaultExpiration); err != nil {
-		return nil, errors.WithStack(err)
-	}
-
-	// 4. Return fetched object
-	return entity.(*T), nil
+	return NewRepository[T, INT](newDefaultClient(cache), entityKeyPrefix).GetEntityByID(ctx, id, getEntityByID)
 }
 
-// GetEntitiesByID retrieves entity list with cache-aside pattern
-// Implements:
-// 1. Batch cache lookup with singleflight deduplication
-// 2. Database fallback on cache miss
-// 3. Cache population with serialized results
+// GetEntitiesByID retrieves entity list with cache-aside pattern.
+// See Repository.GetEntitiesByID for details.
 func GetEntitiesByID[T CacheableEntity[INT], INT constraints.Unsigned](
 	ctx context.Context,
 	cache Cache,
@@ -218,61 +332,25 @@ func GetEntitiesByID[T CacheableEntity[INT], INT constraints.Unsigned](
 	id INT,
 	getEntitiesByID func(context.Context, INT) ([]*T, error),
 ) ([]*T, error) {
-	var err error
-	var items []*T
-
-	// 0. When cache is disabled, directly query database
-	if Disabled {
-		if items, err = getEntitiesByID(ctx, id); err != nil {
-			return nil, errors.WithStack(err)
-		}
-		return items, nil
-	}
-
-	// 1. Attempt to retrieve from cache first
-	key := fmt.Sprintf("%s%citems%c%d", entityKeyPrefix, Delimiter, Delimiter, id)
-
-	data, err := cache.Get(ctx, key)
-	if err != nil && !cache.IsKeyNotFound(err) {
-		return nil, errors.WithStack(err)
-	}
-
-	if err == nil {
-		// 2. If cached data exists, deserialize and return the entity list
-		if err = Unmarshal(data, &items); err == nil {
-			return items, nil
-		}
-		// If deserialization fails, continue execution flow
-	}
-
-	// 2. Fallback to database query if cache miss
-	entities, err, _ := singleFlightGroup.Do(key, func() (any, error) {
-		return getEntitiesByID(ctx, id)
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	items = entities.([]*T)
-	if len(items) == 0 {
-		return items, nil
-	}
-
-	// 3. Serialize and cache results for future requests
-	if data, err = Marshal(&items); err != nil {
-		return nil, errors.WithStack(err)
-	}
-	if err = cache.Set(ctx, key, data, DefaultExpiration); err != nil {
-		return nil, errors.WithStack(err)
-	}
-
-	return items, nil
+	return NewRepository[T, INT](newDefaultClient(cache), entityKeyPrefix).GetEntitiesByID(ctx, id, getEntitiesByID)
+}
+
+// GetEntitiesByIDs retrieves multiple entities by ID with one multi-get.
+// See Repository.GetEntitiesByIDs for details.
+func GetEntitiesByIDs[T CacheableEntity[INT], INT constraints.Unsigned](
+	ctx context.Context,
+	cache Cache,
+	entityKeyPrefix string,
+	ids []INT,
+	getEntitiesByIDs func(context.Context, []INT) (map[INT]*T, error),
+) ([]*T, error) {
+	return NewRepository[T, INT](newDefaultClient(cache), entityKeyPrefix).GetEntitiesByIDs(ctx, ids, getEntitiesByIDs)
 }
 
 // UniqueKey defines constraints for database unique keys
 // Used in GetEntityByUniqueKey to enforce:
 // - String or unsigned integer types
-// - Single-field uniqueness (composite keys not supported)
+// - Single-field uniqueness (see GetEntityByCompositeKey for composite keys)
 type UniqueKey interface {
 	~string | constraints.Unsigned
 }
@@ -280,12 +358,11 @@ type UniqueKey interface {
 // GetEntityByUniqueKey implements two-level cache resolution:
 // 1. UK -> PK lookup cache
 // 2. PK -> Entity cache
-// Features:
-// - Prevents cache stampede with singleflight
-// - Automatic cache population for both UK-PK and PK-Entity mappings
 // Limitations:
-// - Composite unique keys not supported
+// - Composite unique keys not supported, use GetEntityByCompositeKey
 // - Fixed cache key format
+//
+// See Repository.GetEntityByUniqueKey for details.
 func GetEntityByUniqueKey[T CacheableEntity[INT], INT constraints.Unsigned, UK UniqueKey](
 	ctx context.Context,
 	cache Cache,
@@ -295,40 +372,9 @@ func GetEntityByUniqueKey[T CacheableEntity[INT], INT constraints.Unsigned, UK U
 	getIDByUK func(context.Context, UK) (INT, error),
 	getEntityByID func(context.Context, INT) (*T, error),
 ) (*T, error) {
-	// 0. When cache is disabled, directly query database
-	if Disabled {
-		id, err := getIDByUK(ctx, ukVal)
-		if err != nil {
-			return nil, errors.WithStack(err)
-		}
-		one, err := getEntityByID(ctx, id)
-		if err != nil {
-			return nil, errors.WithStack(err)
-		}
-		return one, nil
-	}
-
-	// Key represents unique index value
-	// Value stores corresponding primary key ID
-	ukKey := fmt.Sprintf("%s%c%v", ukKeyPrefix, Delimiter, ukVal)
-
-	// 1. Resolve primary key ID using unique index key
-	u64ID, err := cache.GetAsUint64(ctx, ukKey)
-	if err == nil {
-		return GetEntityByID(ctx, cache, entityKeyPrefix, INT(u64ID), getEntityByID)
-	}
-	if !cache.IsKeyNotFound(err) { // Handle unexpected errors beyond cache miss
-		return nil, errors.WithStack(err)
-	}
-	// 2. If the primary key ID of the database table is not found, call the query function to obtain the primary key ID value.
-	id, err := getIDByUK(ctx, ukVal)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-	// 3. Persist unique index to primary key mapping
-	if err = cache.SetUint64(ctx, ukKey, uint64(id), -1); err != nil {
-		return nil, errors.WithStack(err)
-	}
-	// 4. Retrieve entity using resolved primary key
-	return GetEntityByID(ctx, cache, entityKeyPrefix, id, getEntityByID)
+	return NewRepository[T, INT](newDefaultClient(cache), entityKeyPrefix).GetEntityByUniqueKey(
+		ctx, ukKeyPrefix, ukVal,
+		func(ctx context.Context) (INT, error) { return getIDByUK(ctx, ukVal) },
+		getEntityByID,
+	)
 }
@@ -0,0 +1,377 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errKeyNotFound = errors.New("key not found")
+
+// mapCache is a minimal map-based Cache implementation used by tests
+type mapCache struct {
+	mu      sync.Mutex
+	items   map[string]any
+	expires map[string]time.Duration
+	sets    int
+	mgets   int
+	dels    int
+}
+
+func newMapCache() *mapCache {
+	return &mapCache{
+		items:   make(map[string]any),
+		expires: make(map[string]time.Duration),
+	}
+}
+
+func (c *mapCache) Del(ctx context.Context, keys ...string) (affected int64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dels++
+	for _, key := range keys {
+		if _, ok := c.items[key]; ok {
+			delete(c.items, key)
+			affected++
+		}
+	}
+	return affected, nil
+}
+
+func (c *mapCache) Get(ctx context.Context, key string) (val []byte, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.items[key]
+	if !ok {
+		return nil, errKeyNotFound
+	}
+	return v.([]byte), nil
+}
+
+func (c *mapCache) Set(ctx context.Context, key string, val []byte, expire time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items[key] = val
+	c.expires[key] = expire
+	c.sets++
+	return nil
+}
+
+func (c *mapCache) GetAsUint64(ctx context.Context, key string) (val uint64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.items[key]
+	if !ok {
+		return 0, errKeyNotFound
+	}
+	return v.(uint64), nil
+}
+
+func (c *mapCache) SetUint64(ctx context.Context, key string, val uint64, expire time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items[key] = val
+	c.expires[key] = expire
+	c.sets++
+	return nil
+}
+
+func (c *mapCache) MGet(ctx context.Context, keys ...string) (vals [][]byte, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mgets++
+	vals = make([][]byte, len(keys))
+	for i, key := range keys {
+		if v, ok := c.items[key]; ok {
+			vals[i] = v.([]byte)
+		}
+	}
+	return vals, nil
+}
+
+func (c *mapCache) MSet(ctx context.Context, items map[string][]byte, expire time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, val := range items {
+		c.items[key] = val
+		c.sets++
+	}
+	return nil
+}
+
+func (c *mapCache) IsKeyNotFound(err error) bool {
+	return errors.Is(err, errKeyNotFound)
+}
+
+type user struct {
+	UID  uint64 `json:"id"`
+	Name string `json:"name"`
+}
+
+func (u user) ID() uint64 {
+	return u.UID
+}
+
+func TestGetEntityByID(t *testing.T) {
+	ctx := context.Background()
+	cache := newMapCache()
+
+	var calls int
+	load := func(ctx context.Context, id uint64) (*user, error) {
+		calls++
+		return &user{UID: id, Name: "foo"}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		one, err := GetEntityByID(ctx, cache, "user", uint64(1), load)
+		assert.Nil(t, err)
+		assert.Equal(t, &user{UID: 1, Name: "foo"}, one)
+	}
+	assert.Equal(t, 1, calls)
+	assert.Contains(t, cache.items, "user:1")
+}
+
+func TestGetEntitiesByIDs(t *testing.T) {
+	ctx := context.Background()
+	cache := newMapCache()
+
+	var loaded [][]uint64
+	load := func(ctx context.Context, ids []uint64) (map[uint64]*user, error) {
+		loaded = append(loaded, ids)
+		m := make(map[uint64]*user, len(ids))
+		for _, id := range ids {
+			if id == 404 {
+				continue
+			}
+			m[id] = &user{UID: id}
+		}
+		return m, nil
+	}
+
+	t.Run("Cold cache", func(t *testing.T) {
+		items, err := GetEntitiesByIDs(ctx, cache, "user", []uint64{3, 1, 404, 2}, load)
+		assert.Nil(t, err)
+		assert.Equal(t, []*user{{UID: 3}, {UID: 1}, {UID: 2}}, items)
+		assert.Equal(t, [][]uint64{{3, 1, 404, 2}}, loaded)
+		assert.Equal(t, 1, cache.mgets)
+		assert.Equal(t, 3, cache.sets)
+	})
+
+	t.Run("Partially warm cache", func(t *testing.T) {
+		loaded = nil
+		items, err := GetEntitiesByIDs(ctx, cache, "user", []uint64{2, 5, 1, 5}, load)
+		assert.Nil(t, err)
+		assert.Equal(t, []*user{{UID: 2}, {UID: 5}, {UID: 1}, {UID: 5}}, items)
+		assert.Equal(t, [][]uint64{{5}}, loaded)
+		assert.Equal(t, 2, cache.mgets)
+	})
+
+	t.Run("Warm cache", func(t *testing.T) {
+		loaded = nil
+		items, err := GetEntitiesByIDs(ctx, cache, "user", []uint64{1, 2, 3}, load)
+		assert.Nil(t, err)
+		assert.Equal(t, []*user{{UID: 1}, {UID: 2}, {UID: 3}}, items)
+		assert.Nil(t, loaded)
+	})
+
+	t.Run("Empty IDs", func(t *testing.T) {
+		items, err := GetEntitiesByIDs(ctx, cache, "user", nil, load)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(items))
+	})
+}
+
+func TestNegativeCache(t *testing.T) {
+	errNoRows := errors.New("no rows")
+	NegativeExpiration = time.Minute
+	IsNotFound = func(err error) bool { return errors.Is(err, errNoRows) }
+	defer func() {
+		NegativeExpiration = 0
+		IsNotFound = nil
+	}()
+
+	ctx := context.Background()
+	cache := newMapCache()
+
+	t.Run("GetEntityByID", func(t *testing.T) {
+		var calls int
+		load := func(ctx context.Context, id uint64) (*user, error) {
+			calls++
+			return nil, errNoRows
+		}
+
+		for i := 0; i < 3; i++ {
+			one, err := GetEntityByID(ctx, cache, "user", uint64(404), load)
+			assert.ErrorIs(t, err, ErrEntityNotFound)
+			assert.Nil(t, one)
+		}
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("GetEntitiesByIDs", func(t *testing.T) {
+		var loaded [][]uint64
+		load := func(ctx context.Context, ids []uint64) (map[uint64]*user, error) {
+			loaded = append(loaded, ids)
+			return map[uint64]*user{1: {UID: 1}}, nil
+		}
+
+		for i := 0; i < 2; i++ {
+			items, err := GetEntitiesByIDs(ctx, cache, "user", []uint64{1, 405}, load)
+			assert.Nil(t, err)
+			assert.Equal(t, []*user{{UID: 1}}, items)
+		}
+		assert.Equal(t, [][]uint64{{1, 405}}, loaded)
+	})
+
+	t.Run("Other errors are not cached", func(t *testing.T) {
+		errConn := errors.New("connection refused")
+		var calls int
+		load := func(ctx context.Context, id uint64) (*user, error) {
+			calls++
+			return nil, errConn
+		}
+
+		for i := 0; i < 2; i++ {
+			_, err := GetEntityByID(ctx, cache, "user", uint64(500), load)
+			assert.ErrorIs(t, err, errConn)
+		}
+		assert.Equal(t, 2, calls)
+	})
+}
+
+func TestVersionedWrites(t *testing.T) {
+	ctx := context.Background()
+	cache := &versionedMapCache{mapCache: newMapCache(), versions: make(map[string]uint64)}
+	repo := NewRepository[user, uint64](NewClient(cache, WithVersionedWrites(true)), "user")
+
+	loading, invalidated := make(chan struct{}), make(chan struct{})
+	load := func(ctx context.Context, id uint64) (*user, error) {
+		close(loading)
+		<-invalidated
+		return &user{UID: id, Name: "stale"}, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		one, err := repo.GetEntityByID(ctx, 1, load)
+		assert.Nil(t, err)
+		assert.Equal(t, "stale", one.Name)
+	}()
+
+	<-loading
+	_, err := repo.DelCachedEntity(ctx, 1)
+	assert.Nil(t, err)
+	close(invalidated)
+	<-done
+
+	// The value loaded before the invalidation was not written back
+	_, err = cache.Get(ctx, "user:1")
+	assert.True(t, cache.IsKeyNotFound(err))
+
+	one, err := repo.GetEntityByID(ctx, 1, func(ctx context.Context, id uint64) (*user, error) {
+		return &user{UID: id, Name: "fresh"}, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "fresh", one.Name)
+	assert.Contains(t, cache.items, "user:1")
+}
+
+// versionedMapCache adds key generations to mapCache
+type versionedMapCache struct {
+	*mapCache
+	versions map[string]uint64
+}
+
+func (c *versionedMapCache) Version(ctx context.Context, key string) (version uint64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.versions[key], nil
+}
+
+func (c *versionedMapCache) SetIfVersion(ctx context.Context, key string, version uint64, val []byte, expire time.Duration) (ok bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.versions[key] != version {
+		return false, nil
+	}
+	c.items[key] = val
+	c.expires[key] = expire
+	return true, nil
+}
+
+func (c *versionedMapCache) Invalidate(ctx context.Context, keys ...string) (affected int64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		c.versions[key]++
+		if _, ok := c.items[key]; ok {
+			delete(c.items, key)
+			affected++
+		}
+	}
+	return affected, nil
+}
+
+func TestInvalidateEntity(t *testing.T) {
+	ctx := context.Background()
+	cache := newMapCache()
+
+	load := func(ctx context.Context, id uint64) (*user, error) {
+		return &user{UID: id, Name: "foo"}, nil
+	}
+	loadItems := func(ctx context.Context, id uint64) ([]*user, error) {
+		return []*user{{UID: id}}, nil
+	}
+	getIDByName := func(ctx context.Context, name string) (uint64, error) {
+		return 1, nil
+	}
+	getIDByTenantSlug := func(ctx context.Context, uk tenantSlug) (uint64, error) {
+		return 1, nil
+	}
+
+	_, err := GetEntityByUniqueKey(ctx, cache, "user", "user:name", "foo", getIDByName, load)
+	assert.Nil(t, err)
+	_, err = GetEntityByCompositeKey(ctx, cache, "user", "user:tenant_slug", tenantSlug{TenantID: 2, Slug: "foo"}, getIDByTenantSlug, load)
+	assert.Nil(t, err)
+	_, err = GetEntitiesByID(ctx, cache, "user", uint64(1), loadItems)
+	assert.Nil(t, err)
+	_, err = GetEntityByID(ctx, cache, "user", uint64(2), load)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(cache.items))
+
+	affected, err := InvalidateEntity(ctx, cache, "user", uint64(1),
+		UniqueKeyRef{Prefix: "user:name", Value: "foo"},
+		UniqueKeyRef{Prefix: "user:tenant_slug", Value: tenantSlug{TenantID: 2, Slug: "foo"}},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), affected)
+	assert.Equal(t, 1, cache.dels)
+	assert.Equal(t, map[string]any{"user:2": cache.items["user:2"]}, cache.items)
+
+	_, err = InvalidateEntity(ctx, cache, "user", uint64(1), UniqueKeyRef{Prefix: "user:uk", Value: Tuple{1.5}})
+	assert.ErrorIs(t, err, ErrUnsupportedUniqueKey)
+}
@@ -0,0 +1,475 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package hotkey
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/voidint/box/ecache"
+)
+
+var (
+	_ ecache.Cache          = (*cache)(nil) // Ensure cache implements ecache.Cache interface.
+	_ ecache.VersionedCache = (*cache)(nil) // Ensure cache implements ecache.VersionedCache interface.
+	_ ecache.TaggedCache    = (*cache)(nil) // Ensure cache implements ecache.TaggedCache interface.
+	_ ecache.ExpiringCache  = (*cache)(nil) // Ensure cache implements ecache.ExpiringCache interface.
+	_ ecache.Locker         = (*cache)(nil) // Ensure cache implements ecache.Locker interface.
+	_ ecache.Unwrapper      = (*cache)(nil) // Ensure cache implements ecache.Unwrapper interface.
+)
+
+const (
+	// DefaultTopN is the default number of hot keys mirrored locally
+	DefaultTopN = 100
+	// DefaultLocalTTL is the default time-to-live of local copies
+	DefaultLocalTTL = time.Second
+	// DefaultThreshold is the default number of recent accesses making a key hot
+	DefaultThreshold = 16
+	// DefaultSketchWidth is the default number of counters per sketch row
+	DefaultSketchWidth = 1 << 16
+)
+
+// WithTopN sets the maximum number of hot keys mirrored locally
+func WithTopN(n int) func(*cache) {
+	return func(c *cache) {
+		c.topN = n
+	}
+}
+
+// WithLocalTTL sets the time-to-live of local copies, which bounds how
+// stale they get when the remote cache is written by other instances
+func WithLocalTTL(ttl time.Duration) func(*cache) {
+	return func(c *cache) {
+		c.localTTL = ttl
+	}
+}
+
+// WithThreshold sets the estimated number of recent accesses from which a
+// key is considered hot
+func WithThreshold(count uint64) func(*cache) {
+	return func(c *cache) {
+		c.threshold = count
+	}
+}
+
+// WithSketchWidth sets the number of counters per row of the count-min
+// sketch. Wider sketches overcount less. Counters are halved every ten
+// times width accesses, so the sketch follows recent traffic.
+func WithSketchWidth(width int) func(*cache) {
+	return func(c *cache) {
+		c.sketchWidth = width
+	}
+}
+
+// HotKey is a key currently mirrored locally
+type HotKey struct {
+	Key   string
+	Count uint64 // Estimated number of recent accesses
+}
+
+// local is the local copy of a hot key
+type local struct {
+	val     []byte
+	expires time.Time
+}
+
+// cache tracks access frequencies of keys read from a remote cache
+// (typically ecache/redis) with a count-min sketch, and mirrors the values
+// of the top-N hottest keys in process for a short TTL.
+//
+// Writes and deletes through the cache drop local copies. Writes by other
+// instances are seen once the local copy expires, or immediately when
+// Drop is subscribed to an ecache.InvalidationBus.
+//
+// The optional interfaces of ecache are forwarded to the remote cache, and
+// are in effect when it implements them (see ecache.As).
+type cache struct {
+	remote      ecache.Cache
+	topN        int
+	localTTL    time.Duration
+	threshold   uint64
+	sketchWidth int
+	now         func() time.Time
+
+	mu       sync.Mutex
+	sketch   *sketch
+	accesses int
+	top      map[string]uint64 // Hot keys with their estimated counts
+	minKey   string            // Coldest hot key, valid while minValid
+	minValid bool
+	locals   map[string]local
+	writes   uint64 // Bumped by every write, guards local fills racing with writes
+}
+
+// NewCache creates a cache mirroring the hottest keys of remote locally.
+// remote: Shared cache, typically ecache/redis
+func NewCache(remote ecache.Cache, opts ...func(*cache)) *cache {
+	c := cache{
+		remote:      remote,
+		topN:        DefaultTopN,
+		localTTL:    DefaultLocalTTL,
+		threshold:   DefaultThreshold,
+		sketchWidth: DefaultSketchWidth,
+		now:         time.Now,
+		top:         make(map[string]uint64),
+		locals:      make(map[string]local),
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	c.sketch = newSketch(c.sketchWidth)
+	return &c
+}
+
+// HotKeys returns the keys currently considered hot, hottest first
+func (c *cache) HotKeys() []HotKey {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]HotKey, 0, len(c.top))
+	for key, count := range c.top {
+		keys = append(keys, HotKey{Key: key, Count: count})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Count != keys[j].Count {
+			return keys[i].Count > keys[j].Count
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	return keys
+}
+
+// Drop removes the local copies of keys, leaving the remote cache alone.
+// Its signature matches the handler of ecache.InvalidationBus.Subscribe.
+func (c *cache) Drop(keys []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drop(keys...)
+}
+
+// Del removes multiple keys from the remote cache and their local copies.
+// Returns number of keys deleted from the remote cache.
+func (c *cache) Del(ctx context.Context, keys ...string) (affected int64, err error) {
+	c.Drop(keys)
+	if affected, err = c.remote.Del(ctx, keys...); err != nil {
+		return affected, errors.WithStack(err)
+	}
+	return affected, nil
+}
+
+// Get retrieves byte slice value, from the local copy for hot keys.
+// Values of hot keys read from the remote cache are copied locally.
+func (c *cache) Get(ctx context.Context, key string) (val []byte, err error) {
+	c.mu.Lock()
+	hot := c.record(key)
+	if hot {
+		if l, ok := c.locals[key]; ok && c.now().Before(l.expires) {
+			c.mu.Unlock()
+			return l.val, nil
+		}
+	}
+	writes := c.writes
+	c.mu.Unlock()
+
+	if val, err = c.remote.Get(ctx, key); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if hot {
+		c.fill(writes, map[string][]byte{key: val})
+	}
+	return val, nil
+}
+
+// Set stores value in the remote cache and drops its local copy.
+func (c *cache) Set(ctx context.Context, key string, val []byte, expire time.Duration) (err error) {
+	c.Drop([]string{key})
+	if err = c.remote.Set(ctx, key, val, expire); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// GetAsUint64 retrieves uint64 value from the remote cache.
+// Numeric values are not tracked.
+func (c *cache) GetAsUint64(ctx context.Context, key string) (val uint64, err error) {
+	if val, err = c.remote.GetAsUint64(ctx, key); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return val, nil
+}
+
+// SetUint64 stores uint64 value in the remote cache.
+func (c *cache) SetUint64(ctx context.Context, key string, val uint64, expire time.Duration) (err error) {
+	if err = c.remote.SetUint64(ctx, key, val, expire); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// MGet retrieves values of hot keys from their local copies, then the
+// remaining keys from the remote cache in one call.
+func (c *cache) MGet(ctx context.Context, keys ...string) (vals [][]byte, err error) {
+	vals = make([][]byte, len(keys))
+	hot := make(map[string]bool)
+	missed := make([]int, 0, len(keys))
+	missedKeys := make([]string, 0, len(keys))
+
+	c.mu.Lock()
+	now := c.now()
+	for i, key := range keys {
+		if c.record(key) {
+			hot[key] = true
+			if l, ok := c.locals[key]; ok && now.Before(l.expires) {
+				vals[i] = l.val
+				continue
+			}
+		}
+		missed = append(missed, i)
+		missedKeys = append(missedKeys, key)
+	}
+	writes := c.writes
+	c.mu.Unlock()
+
+	if len(missed) == 0 {
+		return vals, nil
+	}
+	remoteVals, err := c.remote.MGet(ctx, missedKeys...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	fills := make(map[string][]byte)
+	for j, i := range missed {
+		vals[i] = remoteVals[j]
+		if remoteVals[j] != nil && hot[keys[i]] {
+			fills[keys[i]] = remoteVals[j]
+		}
+	}
+	c.fill(writes, fills)
+	return vals, nil
+}
+
+// MSet stores multiple values in the remote cache and drops their local copies.
+func (c *cache) MSet(ctx context.Context, items map[string][]byte, expire time.Duration) (err error) {
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	c.Drop(keys)
+	if err = c.remote.MSet(ctx, items, expire); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Unwrap returns the remote cache
+func (c *cache) Unwrap() ecache.Cache {
+	return c.remote
+}
+
+// Version retrieves the generation of key from the remote cache.
+// Returns ecache.ErrUnsupported if the remote cache has no key generations.
+func (c *cache) Version(ctx context.Context, key string) (version uint64, err error) {
+	vc, ok := c.remote.(ecache.VersionedCache)
+	if !ok {
+		return 0, errors.WithStack(ecache.ErrUnsupported)
+	}
+	if version, err = vc.Version(ctx, key); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return version, nil
+}
+
+// SetIfVersion stores value in the remote cache if the generation of key
+// still equals version, and drops its local copy.
+func (c *cache) SetIfVersion(ctx context.Context, key string, version uint64, val []byte, expire time.Duration) (ok bool, err error) {
+	vc, ok := c.remote.(ecache.VersionedCache)
+	if !ok {
+		return false, errors.WithStack(ecache.ErrUnsupported)
+	}
+	c.Drop([]string{key})
+	if ok, err = vc.SetIfVersion(ctx, key, version, val, expire); err != nil {
+		return false, errors.WithStack(err)
+	}
+	return ok, nil
+}
+
+// Invalidate removes keys from the remote cache, bumping their generations,
+// and their local copies.
+// Returns number of keys deleted from the remote cache.
+func (c *cache) Invalidate(ctx context.Context, keys ...string) (affected int64, err error) {
+	vc, ok := c.remote.(ecache.VersionedCache)
+	if !ok {
+		return 0, errors.WithStack(ecache.ErrUnsupported)
+	}
+	c.Drop(keys)
+	if affected, err = vc.Invalidate(ctx, keys...); err != nil {
+		return affected, errors.WithStack(err)
+	}
+	return affected, nil
+}
+
+// Tag adds keys to the tag index of the remote cache.
+// Returns ecache.ErrTagsUnsupported if the remote cache has no tag index.
+func (c *cache) Tag(ctx context.Context, tag string, expire time.Duration, keys ...string) (err error) {
+	tc, ok := c.remote.(ecache.TaggedCache)
+	if !ok {
+		return errors.WithStack(ecache.ErrTagsUnsupported)
+	}
+	if err = tc.Tag(ctx, tag, expire, keys...); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// PopTag retrieves and removes the tag index of the remote cache.
+// Returns ecache.ErrTagsUnsupported if the remote cache has no tag index.
+func (c *cache) PopTag(ctx context.Context, tag string) (keys []string, err error) {
+	tc, ok := c.remote.(ecache.TaggedCache)
+	if !ok {
+		return nil, errors.WithStack(ecache.ErrTagsUnsupported)
+	}
+	if keys, err = tc.PopTag(ctx, tag); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return keys, nil
+}
+
+// TTL retrieves the remaining time-to-live of entries from the remote cache.
+// Returns ecache.ErrUnsupported if the remote cache does not report TTLs.
+func (c *cache) TTL(ctx context.Context, keys ...string) (ttls []time.Duration, err error) {
+	ec, ok := c.remote.(ecache.ExpiringCache)
+	if !ok {
+		return nil, errors.WithStack(ecache.ErrUnsupported)
+	}
+	if ttls, err = ec.TTL(ctx, keys...); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return ttls, nil
+}
+
+// TryLock acquires lock key in the remote cache.
+// Returns ecache.ErrUnsupported if the remote cache has no locks.
+func (c *cache) TryLock(ctx context.Context, key string, ttl time.Duration) (unlock func(context.Context) error, ok bool, err error) {
+	locker, ok := c.remote.(ecache.Locker)
+	if !ok {
+		return nil, false, errors.WithStack(ecache.ErrUnsupported)
+	}
+	if unlock, ok, err = locker.TryLock(ctx, key, ttl); err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	return unlock, ok, nil
+}
+
+// IsKeyNotFound checks if error represents missing key in the remote cache.
+func (c *cache) IsKeyNotFound(err error) bool {
+	return c.remote.IsKeyNotFound(err)
+}
+
+// record counts one access of key and reports whether key is hot.
+// Must be called with mu held.
+func (c *cache) record(key string) (hot bool) {
+	if c.accesses++; c.accesses >= 10*c.sketchWidth {
+		c.age()
+	}
+	count := c.sketch.add(key)
+
+	if _, ok := c.top[key]; ok {
+		c.top[key] = count
+		c.minValid = c.minValid && key != c.minKey
+		return true
+	}
+	if count < c.threshold || c.topN <= 0 {
+		return false
+	}
+	if len(c.top) >= c.topN {
+		minKey := c.coldest()
+		if count <= c.top[minKey] {
+			return false
+		}
+		delete(c.top, minKey)
+		c.drop(minKey)
+	}
+	c.top[key] = count
+	c.minValid = false
+	return true
+}
+
+// coldest returns the hot key with the lowest count.
+// Must be called with mu held.
+func (c *cache) coldest() string {
+	if !c.minValid {
+		first := true
+		var minCount uint64
+		for key, count := range c.top {
+			if first || count < minCount {
+				c.minKey, minCount, first = key, count, false
+			}
+		}
+		c.minValid = true
+	}
+	return c.minKey
+}
+
+// age halves every count, so keys that cooled down leave the top.
+// Must be called with mu held.
+func (c *cache) age() {
+	c.accesses = 0
+	c.sketch.halve()
+	for key, count := range c.top {
+		if count >>= 1; count < c.threshold {
+			delete(c.top, key)
+			c.drop(key)
+			continue
+		}
+		c.top[key] = count
+	}
+	c.minValid = false
+}
+
+// fill stores local copies of hot keys read from the remote cache,
+// unless a write happened since writes was read
+func (c *cache) fill(writes uint64, items map[string][]byte) {
+	if len(items) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.writes != writes {
+		return
+	}
+	expires := c.now().Add(c.localTTL)
+	for key, val := range items {
+		if _, ok := c.top[key]; ok {
+			c.locals[key] = local{val: val, expires: expires}
+		}
+	}
+}
+
+// drop removes local copies of keys and invalidates fills in flight.
+// Must be called with mu held.
+func (c *cache) drop(keys ...string) {
+	c.writes++
+	for _, key := range keys {
+		delete(c.locals, key)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package hotkey
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/voidint/box/ecache"
+	"github.com/voidint/box/ecache/memory"
+)
+
+// countingCache counts reads reaching the remote cache
+type countingCache struct {
+	ecache.Cache
+	gets  int
+	mgets int
+}
+
+func (c *countingCache) Get(ctx context.Context, key string) ([]byte, error) {
+	c.gets++
+	return c.Cache.Get(ctx, key)
+}
+
+func (c *countingCache) MGet(ctx context.Context, keys ...string) ([][]byte, error) {
+	c.mgets++
+	return c.Cache.MGet(ctx, keys...)
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	remote := &countingCache{Cache: memory.NewCache(time.Minute, 0)}
+	now := time.Now()
+	c := NewCache(remote, WithTopN(1), WithThreshold(3), WithLocalTTL(time.Second))
+	c.now = func() time.Time { return now }
+
+	assert.Nil(t, c.Set(ctx, "hot", []byte("v1"), 0))
+	assert.Nil(t, c.Set(ctx, "warm", []byte("w1"), 0))
+
+	// Cold reads go to the remote cache
+	for i := 0; i < 2; i++ {
+		val, err := c.Get(ctx, "hot")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("v1"), val)
+	}
+	assert.Equal(t, 2, remote.gets)
+	assert.Empty(t, c.HotKeys())
+
+	// The third read makes the key hot and copies it locally
+	_, err := c.Get(ctx, "hot")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, remote.gets)
+	val, err := c.Get(ctx, "hot")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), val)
+	assert.Equal(t, 3, remote.gets)
+	assert.Equal(t, []HotKey{{Key: "hot", Count: 4}}, c.HotKeys())
+
+	vals, err := c.MGet(ctx, "hot", "warm")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("v1"), []byte("w1")}, vals)
+	assert.Equal(t, 1, remote.mgets)
+
+	// Writes drop the local copy
+	assert.Nil(t, c.Set(ctx, "hot", []byte("v2"), 0))
+	val, err = c.Get(ctx, "hot")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), val)
+
+	// Writes by other instances are seen after the local TTL
+	assert.Nil(t, remote.Set(ctx, "hot", []byte("v3"), 0))
+	val, _ = c.Get(ctx, "hot")
+	assert.Equal(t, []byte("v2"), val)
+	now = now.Add(2 * time.Second)
+	val, _ = c.Get(ctx, "hot")
+	assert.Equal(t, []byte("v3"), val)
+
+	// Or immediately once dropped, e.g. from an invalidation bus
+	assert.Nil(t, remote.Set(ctx, "hot", []byte("v4"), 0))
+	c.Drop([]string{"hot"})
+	val, _ = c.Get(ctx, "hot")
+	assert.Equal(t, []byte("v4"), val)
+
+	// A hotter key takes the only slot
+	for i := 0; i < 10; i++ {
+		_, err = c.Get(ctx, "warm")
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, "warm", c.HotKeys()[0].Key)
+	assert.Equal(t, 1, len(c.HotKeys()))
+
+	_, err = c.Get(ctx, "missing")
+	assert.True(t, c.IsKeyNotFound(err))
+}
+
+func TestOptionalInterfaces(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Not in effect without the remote cache", func(t *testing.T) {
+		c := NewCache(&countingCache{Cache: memory.NewCache(time.Minute, 0)})
+		_, ok := ecache.As[ecache.VersionedCache](c)
+		assert.False(t, ok)
+		_, ok = ecache.As[ecache.TaggedCache](c)
+		assert.False(t, ok)
+		_, err := c.Version(ctx, "hot")
+		assert.ErrorIs(t, err, ecache.ErrUnsupported)
+	})
+
+	t.Run("Forwarded to the remote cache", func(t *testing.T) {
+		remote := memory.NewCache(time.Minute, 0)
+		c := NewCache(remote, WithThreshold(1), WithLocalTTL(time.Minute))
+		_, ok := ecache.As[ecache.VersionedCache](c)
+		assert.True(t, ok)
+		_, ok = ecache.As[ecache.TaggedCache](c)
+		assert.True(t, ok)
+
+		// Invalidation drops the local copy of a hot key
+		assert.Nil(t, c.Set(ctx, "hot", []byte("v1"), 0))
+		_, err := c.Get(ctx, "hot")
+		assert.Nil(t, err)
+		assert.Nil(t, remote.Set(ctx, "hot", []byte("v2"), 0))
+		val, err := c.Get(ctx, "hot")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("v1"), val)
+
+		affected, err := c.Invalidate(ctx, "hot")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), affected)
+		_, err = c.Get(ctx, "hot")
+		assert.True(t, c.IsKeyNotFound(err))
+
+		ok, err = c.SetIfVersion(ctx, "hot", 0, []byte("stale"), 0)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		version, err := c.Version(ctx, "hot")
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), version)
+	})
+}
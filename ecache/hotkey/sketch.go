@@ -0,0 +1,72 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package hotkey
+
+import (
+	"hash/maphash"
+)
+
+// sketchDepth is the number of rows of the count-min sketch
+const sketchDepth = 4
+
+// sketch is a count-min sketch estimating access frequencies in fixed
+// memory. Estimates never undercount, collisions may overcount.
+type sketch struct {
+	seeds [sketchDepth]maphash.Seed
+	rows  [sketchDepth][]uint32
+	mask  uint64
+}
+
+// newSketch creates a sketch with width counters per row,
+// rounded up to a power of two
+func newSketch(width int) *sketch {
+	size := 1
+	for size < width {
+		size <<= 1
+	}
+	s := sketch{mask: uint64(size - 1)}
+	for i := range s.rows {
+		s.seeds[i] = maphash.MakeSeed()
+		s.rows[i] = make([]uint32, size)
+	}
+	return &s
+}
+
+// add counts one access of key and returns its estimated frequency
+func (s *sketch) add(key string) uint64 {
+	estimate := uint64(1<<64 - 1)
+	for i := range s.rows {
+		idx := maphash.String(s.seeds[i], key) & s.mask
+		if s.rows[i][idx] < 1<<32-1 {
+			s.rows[i][idx]++
+		}
+		estimate = min(estimate, uint64(s.rows[i][idx]))
+	}
+	return estimate
+}
+
+// halve divides every counter by two, so past accesses weigh less
+func (s *sketch) halve() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+}
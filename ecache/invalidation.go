@@ -0,0 +1,112 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// InvalidationBus broadcasts deleted cache keys to every instance,
+// so in-process caches can drop entries deleted elsewhere.
+type InvalidationBus interface {
+	// Publish broadcasts keys deleted by this instance.
+	//
+	// Args:
+	//   ctx: Context for request cancellation/timeout
+	//   keys: Deleted cache keys
+	//
+	// Returns:
+	//   error: Transport errors, nil on success
+	Publish(ctx context.Context, keys ...string) error
+	// Subscribe registers handler for keys deleted by any instance,
+	// including this one. Handlers must be safe for concurrent use.
+	//
+	// Args:
+	//   ctx: Context for request cancellation/timeout of the subscription setup
+	//   handler: Callback receiving deleted keys
+	//
+	// Returns:
+	//   unsubscribe: Stops delivering keys to handler
+	//   err: Transport errors, nil on success
+	Subscribe(ctx context.Context, handler func(keys []string)) (unsubscribe func() error, err error)
+}
+
+// DropOnInvalidation subscribes cache to bus, deleting every broadcast key
+// from it. It is typically used with an ecache/memory cache in each instance.
+func DropOnInvalidation(ctx context.Context, bus InvalidationBus, cache Cache) (unsubscribe func() error, err error) {
+	if unsubscribe, err = bus.Subscribe(ctx, func(keys []string) {
+		_, _ = cache.Del(context.Background(), keys...)
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return unsubscribe, nil
+}
+
+var _ InvalidationBus = (*LocalBus)(nil) // Ensure LocalBus implements InvalidationBus interface.
+
+// LocalBus is an in-process InvalidationBus delivering keys synchronously.
+// It connects caches within one process, which makes it suitable for tests.
+type LocalBus struct {
+	mu       sync.RWMutex
+	nextID   uint64
+	handlers map[uint64]func(keys []string)
+}
+
+// NewLocalBus creates an in-process invalidation bus
+func NewLocalBus() *LocalBus {
+	return &LocalBus{
+		handlers: make(map[uint64]func(keys []string)),
+	}
+}
+
+// Publish delivers keys to every subscribed handler before returning
+func (bus *LocalBus) Publish(ctx context.Context, keys ...string) error {
+	bus.mu.RLock()
+	handlers := make([]func(keys []string), 0, len(bus.handlers))
+	for _, handler := range bus.handlers {
+		handlers = append(handlers, handler)
+	}
+	bus.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(keys)
+	}
+	return nil
+}
+
+// Subscribe registers handler for published keys
+func (bus *LocalBus) Subscribe(ctx context.Context, handler func(keys []string)) (unsubscribe func() error, err error) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	id := bus.nextID
+	bus.nextID++
+	bus.handlers[id] = handler
+
+	return func() error {
+		bus.mu.Lock()
+		defer bus.mu.Unlock()
+		delete(bus.handlers, id)
+		return nil
+	}, nil
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvalidationBus(t *testing.T) {
+	ctx := context.Background()
+	bus := NewLocalBus()
+
+	// Two instances, each with its own in-process cache
+	local0, local1 := newMapCache(), newMapCache()
+	unsubscribe0, err := DropOnInvalidation(ctx, bus, local0)
+	assert.Nil(t, err)
+	unsubscribe1, err := DropOnInvalidation(ctx, bus, local1)
+	assert.Nil(t, err)
+
+	load := func(ctx context.Context, id uint64) (*user, error) {
+		return &user{UID: id}, nil
+	}
+	repo0 := NewRepository[user, uint64](NewClient(local0, WithInvalidationBus(bus)), "user")
+	repo1 := NewRepository[user, uint64](NewClient(local1, WithInvalidationBus(bus)), "user")
+	_, err = repo0.GetEntityByID(ctx, 1, load)
+	assert.Nil(t, err)
+	_, err = repo1.GetEntityByID(ctx, 1, load)
+	assert.Nil(t, err)
+	assert.Contains(t, local1.items, "user:1")
+
+	t.Run("Delete is broadcast", func(t *testing.T) {
+		_, err := repo0.DelCachedEntity(ctx, 1)
+		assert.Nil(t, err)
+		assert.NotContains(t, local0.items, "user:1")
+		assert.NotContains(t, local1.items, "user:1")
+	})
+
+	t.Run("Unsubscribe", func(t *testing.T) {
+		assert.Nil(t, unsubscribe1())
+		_, err = repo1.GetEntityByID(ctx, 1, load)
+		assert.Nil(t, err)
+		_, err := repo0.DelCachedEntity(ctx, 1)
+		assert.Nil(t, err)
+		assert.Contains(t, local1.items, "user:1")
+	})
+
+	assert.Nil(t, unsubscribe0())
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrLockTimeout indicates the load lock of a key was not released in time.
+// It is returned only with FailOnLockTimeout, see WithLockFallback.
+var ErrLockTimeout = errors.New("timed out waiting for load lock")
+
+// Locker is implemented by caches providing mutual exclusion of loads
+// across processes, see WithLoadLock
+type Locker interface {
+	// TryLock acquires the lock key for ttl without blocking.
+	//
+	// Args:
+	//   ctx: Context for request cancellation/timeout
+	//   key: Lock identifier
+	//   ttl: Time after which the lock is released if unlock is not called
+	//
+	// Returns:
+	//   unlock: Releases the lock if still held by this acquisition
+	//   ok: False if the lock is held by someone else
+	//   err: Storage errors, nil on success
+	TryLock(ctx context.Context, key string, ttl time.Duration) (unlock func(context.Context) error, ok bool, err error)
+}
+
+// LockFallback selects the behavior when the load lock is not released
+// within the lock wait
+type LockFallback int
+
+const (
+	// LoadOnLockTimeout loads from the database without the lock
+	LoadOnLockTimeout LockFallback = iota
+	// FailOnLockTimeout returns ErrLockTimeout
+	FailOnLockTimeout
+)
+
+const (
+	// DefaultLockWait is the default time spent polling the cache while
+	// another process holds the load lock
+	DefaultLockWait = time.Second
+	// DefaultLockPollInterval is the default interval of cache polls
+	DefaultLockPollInterval = 50 * time.Millisecond
+)
+
+// WithLoadLock makes GetEntityByID take a lock in locker before loading a
+// missing entity, so only one process queries the database for a hot key.
+// Other processes poll the cache until the entity appears, see WithLockWait
+// and WithLockFallback. The lock expires after the load timeout, or
+// DefaultLoadTimeout without one. Errors of locker do not fail lookups,
+// the entity is loaded without the lock then.
+func WithLoadLock(locker Locker) func(*Client) {
+	return func(c *Client) {
+		c.locker = locker
+	}
+}
+
+// WithLockWait sets how long the cache is polled, every poll interval,
+// while another process holds the load lock
+func WithLockWait(wait, pollInterval time.Duration) func(*Client) {
+	return func(c *Client) {
+		c.lockWait = wait
+		c.lockPoll = pollInterval
+	}
+}
+
+// WithLockFallback sets the behavior when the load lock is not released
+// within the lock wait
+func WithLockFallback(fallback LockFallback) func(*Client) {
+	return func(c *Client) {
+		c.lockFallback = fallback
+	}
+}
+
+// lock takes the load lock of key, polling check while it is held by
+// someone else. check reports whether the cache was filled meanwhile.
+// found is true once check succeeds, the lock is released already then.
+// Without a locker, a no-op release is returned.
+func (c *Client) lock(ctx context.Context, key string, check func(context.Context) (bool, error)) (release func(), found bool, err error) {
+	release = func() {}
+	if c.locker == nil {
+		return release, false, nil
+	}
+
+	ttl := c.loadTimeout
+	if ttl <= 0 {
+		ttl = DefaultLoadTimeout
+	}
+	lockKey := c.Key(key, "lock")
+	deadline := c.now().Add(c.lockWait)
+	for {
+		unlock, ok, err := c.locker.TryLock(ctx, lockKey, ttl)
+		if err != nil {
+			return release, false, nil // Degrade to an unlocked load
+		}
+		if ok {
+			release = func() { _ = unlock(context.WithoutCancel(ctx)) }
+			// Double-check: the previous holder may have just filled the cache
+			if found, err = check(ctx); found || err != nil {
+				release()
+				return func() {}, found, err
+			}
+			return release, false, nil
+		}
+
+		select {
+		case <-time.After(c.lockPoll):
+		case <-ctx.Done():
+			return release, false, errors.WithStack(ctx.Err())
+		}
+		if found, err = check(ctx); found || err != nil {
+			return release, found, err
+		}
+		if c.now().After(deadline) {
+			if c.lockFallback == FailOnLockTimeout {
+				return release, false, errors.WithStack(ErrLockTimeout)
+			}
+			return release, false, nil
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mapLocker is a map-based Locker shared by clients standing in for processes
+type mapLocker struct {
+	mu    sync.Mutex
+	locks map[string]bool
+}
+
+func (l *mapLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (unlock func(context.Context) error, ok bool, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.locks[key] {
+		return nil, false, nil
+	}
+	l.locks[key] = true
+	return func(context.Context) error {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.locks, key)
+		return nil
+	}, true, nil
+}
+
+func TestLoadLock(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Single loader across processes", func(t *testing.T) {
+		cache := newMapCache()
+		locker := &mapLocker{locks: make(map[string]bool)}
+		newRepo := func() *Repository[user, uint64] {
+			return NewRepository[user, uint64](NewClient(cache,
+				WithLoadLock(locker),
+				WithLockWait(time.Second, time.Millisecond),
+			), "user")
+		}
+
+		var loads atomic.Int32
+		started := make(chan struct{})
+		proceed := make(chan struct{})
+		load := func(ctx context.Context, id uint64) (*user, error) {
+			if loads.Add(1) == 1 {
+				close(started)
+				<-proceed
+			}
+			return &user{UID: id, Name: "foo"}, nil
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := newRepo().GetEntityByID(ctx, 1, load)
+			assert.Nil(t, err)
+		}()
+		<-started
+
+		done := make(chan *user)
+		go func() {
+			one, err := newRepo().GetEntityByID(ctx, 1, load)
+			assert.Nil(t, err)
+			done <- one
+		}()
+		time.Sleep(10 * time.Millisecond) // Let the second process poll
+		close(proceed)
+
+		assert.Equal(t, "foo", (<-done).Name)
+		wg.Wait()
+		assert.Equal(t, int32(1), loads.Load())
+	})
+
+	t.Run("Fallback", func(t *testing.T) {
+		locker := &mapLocker{locks: map[string]bool{"user:1:lock": true}}
+		load := func(ctx context.Context, id uint64) (*user, error) {
+			return &user{UID: id}, nil
+		}
+
+		repo := NewRepository[user, uint64](NewClient(newMapCache(),
+			WithLoadLock(locker),
+			WithLockWait(5*time.Millisecond, time.Millisecond),
+			WithLockFallback(FailOnLockTimeout),
+		), "user")
+		_, err := repo.GetEntityByID(ctx, 1, load)
+		assert.ErrorIs(t, err, ErrLockTimeout)
+
+		repo = NewRepository[user, uint64](NewClient(newMapCache(),
+			WithLoadLock(locker),
+			WithLockWait(5*time.Millisecond, time.Millisecond),
+		), "user")
+		one, err := repo.GetEntityByID(ctx, 1, load)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), one.UID)
+	})
+}
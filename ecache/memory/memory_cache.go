@@ -21,6 +21,7 @@ package memory
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	gocache "github.com/patrickmn/go-cache"
@@ -36,19 +37,65 @@ var (
 	ErrUnexpectedType = errors.New("unknown data type")
 )
 
-var _ ecache.Cache = (*cache)(nil) // Ensure cache implements ecache.Cache interface.
+var (
+	_ ecache.Cache          = (*cache)(nil) // Ensure cache implements ecache.Cache interface.
+	_ ecache.VersionedCache = (*cache)(nil) // Ensure cache implements ecache.VersionedCache interface.
+	_ ecache.TaggedCache    = (*cache)(nil) // Ensure cache implements ecache.TaggedCache interface.
+	_ ecache.Locker         = (*cache)(nil) // Ensure cache implements ecache.Locker interface.
+	_ ecache.ExpiringCache  = (*cache)(nil) // Ensure cache implements ecache.ExpiringCache interface.
+)
+
+// DefaultVersionTTL is the default time-to-live of key generations
+const DefaultVersionTTL = time.Minute
+
+// WithVersionTTL sets how long a key generation is kept after invalidation.
+// It should exceed the longest loader duration: a loader outliving it may
+// write back data loaded before the invalidation.
+func WithVersionTTL(ttl time.Duration) func(*cache) {
+	return func(c *cache) {
+		c.versionTTL = ttl
+	}
+}
 
 type cache struct {
-	db *gocache.Cache
+	db         *gocache.Cache
+	expiration time.Duration // Default TTL of db entries
+	versions   *gocache.Cache
+	versionTTL time.Duration
+	versionMu  sync.Mutex     // Serializes versioned writes with invalidations
+	tags       *gocache.Cache // Reverse index of tagged keys, see tagIndex
+	tagMu      sync.Mutex
+	locks      map[string]lock
+	lockSeq    uint64
+	lockMu     sync.Mutex
+}
+
+// lock is a held load lock
+type lock struct {
+	token   uint64
+	expires time.Time
 }
 
+// tagIndex maps the keys of a tag to the expiry of their entries,
+// the zero time meaning no expiry
+type tagIndex map[string]time.Time
+
 // NewCache creates an in-memory cache instance with configurable expiration.
 // defaultExpiration: default TTL for cache entries (use time.Duration(0) for no expiration)
 // cleanupInterval: interval for automatic removal of expired entries (use time.Duration(0) to disable)
-func NewCache(defaultExpiration, cleanupInterval time.Duration) *cache {
-	return &cache{
-		db: gocache.New(defaultExpiration, cleanupInterval),
+func NewCache(defaultExpiration, cleanupInterval time.Duration, opts ...func(*cache)) *cache {
+	c := cache{
+		db:         gocache.New(defaultExpiration, cleanupInterval),
+		expiration: defaultExpiration,
+		versionTTL: DefaultVersionTTL,
+		tags:       gocache.New(gocache.NoExpiration, cleanupInterval),
+		locks:      make(map[string]lock),
+	}
+	for _, opt := range opts {
+		opt(&c)
 	}
+	c.versions = gocache.New(c.versionTTL, cleanupInterval)
+	return &c
 }
 
 // Del removes multiple entries from the cache.
@@ -68,8 +115,7 @@ func (c *cache) Get(ctx context.Context, key string) (val []byte, err error) {
 	if !ok {
 		return nil, errors.WithStack(ErrKeyNotFound)
 	}
-	item := v.(gocache.Item)
-	if val, ok = item.Object.([]byte); !ok {
+	if val, ok = v.([]byte); !ok {
 		return nil, errors.WithStack(ErrUnexpectedType)
 	}
 	return val, nil
@@ -83,13 +129,38 @@ func (c *cache) GetAsUint64(ctx context.Context, key string) (val uint64, err er
 	if !ok {
 		return 0, errors.WithStack(ErrKeyNotFound)
 	}
-	item := v.(gocache.Item)
-	if val, ok = item.Object.(uint64); !ok {
+	if val, ok = v.(uint64); !ok {
 		return 0, errors.WithStack(ErrUnexpectedType)
 	}
 	return val, nil
 }
 
+// MGet retrieves multiple values as byte slices from the cache.
+// Returned values are aligned with keys, missing keys yield nil elements
+// Returns ErrUnexpectedType if any value cannot be cast to []byte
+func (c *cache) MGet(ctx context.Context, keys ...string) (vals [][]byte, err error) {
+	vals = make([][]byte, len(keys))
+	for i, key := range keys {
+		v, ok := c.db.Get(key)
+		if !ok {
+			continue
+		}
+		if vals[i], ok = v.([]byte); !ok {
+			return nil, errors.WithStack(ErrUnexpectedType)
+		}
+	}
+	return vals, nil
+}
+
+// MSet stores multiple byte slices in the cache with the same expiration.
+// expire: 0 uses default expiration, <0 means no expiration
+func (c *cache) MSet(ctx context.Context, items map[string][]byte, expire time.Duration) error {
+	for key, val := range items {
+		c.db.Set(key, val, expire)
+	}
+	return nil
+}
+
 // Set stores a byte slice in the cache with expiration.
 // expire: 0 uses default expiration, <0 means no expiration
 func (c *cache) Set(ctx context.Context, key string, val []byte, expire time.Duration) error {
@@ -104,6 +175,151 @@ func (c *cache) SetUint64(ctx context.Context, key string, val uint64, expire ti
 	return nil
 }
 
+// TTL retrieves the remaining time-to-live of entries.
+// Returns 0 for entries without expiration and for missing keys.
+func (c *cache) TTL(ctx context.Context, keys ...string) (ttls []time.Duration, err error) {
+	ttls = make([]time.Duration, len(keys))
+	now := time.Now()
+	for i, key := range keys {
+		if _, expires, ok := c.db.GetWithExpiration(key); ok && !expires.IsZero() {
+			ttls[i] = max(expires.Sub(now), 1) // Not expired yet, keep it positive
+		}
+	}
+	return ttls, nil
+}
+
+// Version retrieves the current generation of key.
+// Returns 0 if key was never invalidated or its generation expired.
+func (c *cache) Version(ctx context.Context, key string) (version uint64, err error) {
+	if v, ok := c.versions.Get(key); ok {
+		version, _ = v.(uint64)
+	}
+	return version, nil
+}
+
+// SetIfVersion stores a byte slice in the cache with expiration if the
+// generation of key still equals version.
+// expire: 0 uses default expiration, <0 means no expiration
+func (c *cache) SetIfVersion(ctx context.Context, key string, version uint64, val []byte, expire time.Duration) (ok bool, err error) {
+	c.versionMu.Lock()
+	defer c.versionMu.Unlock()
+
+	if current, _ := c.Version(ctx, key); current != version {
+		return false, nil
+	}
+	c.db.Set(key, val, expire)
+	return true, nil
+}
+
+// Invalidate removes multiple entries from the cache and bumps their generations.
+// Returns number of invalidated items and any potential error (currently always nil)
+func (c *cache) Invalidate(ctx context.Context, keys ...string) (affected int64, err error) {
+	c.versionMu.Lock()
+	defer c.versionMu.Unlock()
+
+	for _, key := range keys {
+		version, _ := c.Version(ctx, key)
+		c.versions.Set(key, version+1, gocache.DefaultExpiration)
+		c.db.Delete(key)
+	}
+	return int64(len(keys)), nil
+}
+
+// Tag adds keys to the reverse index of tag.
+// expire: TTL of the tagged entries, 0 uses default expiration, <0 means no expiration.
+// Keys whose entries expired are pruned, and the index itself expires with
+// its longest-lived entry.
+func (c *cache) Tag(ctx context.Context, tag string, expire time.Duration, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if expire == 0 {
+		expire = c.expiration
+	}
+	var expires time.Time
+	now := time.Now()
+	if expire > 0 {
+		expires = now.Add(expire)
+	}
+
+	c.tagMu.Lock()
+	defer c.tagMu.Unlock()
+
+	index := make(tagIndex, len(keys))
+	if val, ok := c.tags.Get(tag); ok {
+		for key, keyExpires := range val.(tagIndex) {
+			if keyExpires.IsZero() || keyExpires.After(now) {
+				index[key] = keyExpires
+			}
+		}
+	}
+	for _, key := range keys {
+		if current, ok := index[key]; ok && (current.IsZero() || (!expires.IsZero() && current.After(expires))) {
+			continue // The entry was already tagged with a longer TTL
+		}
+		index[key] = expires
+	}
+
+	var latest time.Time
+	for _, keyExpires := range index {
+		if keyExpires.IsZero() {
+			c.tags.Set(tag, index, gocache.NoExpiration)
+			return nil
+		}
+		if keyExpires.After(latest) {
+			latest = keyExpires
+		}
+	}
+	c.tags.Set(tag, index, latest.Sub(now))
+	return nil
+}
+
+// PopTag retrieves and removes the reverse index of tag, skipping the keys of expired entries.
+// Returns an empty slice for unknown tags and any potential error (currently always nil)
+func (c *cache) PopTag(ctx context.Context, tag string) (keys []string, err error) {
+	c.tagMu.Lock()
+	val, ok := c.tags.Get(tag)
+	c.tags.Delete(tag)
+	c.tagMu.Unlock()
+
+	if !ok {
+		return []string{}, nil
+	}
+	index := val.(tagIndex)
+	now := time.Now()
+	keys = make([]string, 0, len(index))
+	for key, expires := range index {
+		if expires.IsZero() || expires.After(now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// TryLock acquires the in-process lock key for ttl without blocking.
+// It only excludes loads within this process, as the cache itself does.
+func (c *cache) TryLock(ctx context.Context, key string, ttl time.Duration) (unlock func(context.Context) error, ok bool, err error) {
+	c.lockMu.Lock()
+	defer c.lockMu.Unlock()
+
+	now := time.Now()
+	if l, held := c.locks[key]; held && now.Before(l.expires) {
+		return nil, false, nil
+	}
+	c.lockSeq++
+	token := c.lockSeq
+	c.locks[key] = lock{token: token, expires: now.Add(ttl)}
+
+	return func(context.Context) error {
+		c.lockMu.Lock()
+		defer c.lockMu.Unlock()
+		if l, held := c.locks[key]; held && l.token == token {
+			delete(c.locks, key)
+		}
+		return nil
+	}, true, nil
+}
+
 // IsKeyNotFound checks if an error indicates missing key
 // Helps determine error type without direct dependency on package errors
 func (c *cache) IsKeyNotFound(err error) bool {
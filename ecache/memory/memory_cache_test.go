@@ -0,0 +1,173 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(time.Minute, 0)
+
+	t.Run("Get and Set", func(t *testing.T) {
+		_, err := c.Get(ctx, "foo")
+		assert.True(t, c.IsKeyNotFound(err))
+
+		assert.Nil(t, c.Set(ctx, "foo", []byte("bar"), 0))
+		val, err := c.Get(ctx, "foo")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("bar"), val)
+	})
+
+	t.Run("GetAsUint64 and SetUint64", func(t *testing.T) {
+		assert.Nil(t, c.SetUint64(ctx, "uk", 42, -1))
+		val, err := c.GetAsUint64(ctx, "uk")
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(42), val)
+
+		_, err = c.Get(ctx, "uk")
+		assert.ErrorIs(t, err, ErrUnexpectedType)
+	})
+
+	t.Run("MGet and MSet", func(t *testing.T) {
+		assert.Nil(t, c.MSet(ctx, map[string][]byte{"a": []byte("1"), "b": []byte("2")}, 0))
+		vals, err := c.MGet(ctx, "b", "missing", "a")
+		assert.Nil(t, err)
+		assert.Equal(t, [][]byte{[]byte("2"), nil, []byte("1")}, vals)
+	})
+
+	t.Run("Del", func(t *testing.T) {
+		_, err := c.Del(ctx, "foo", "a")
+		assert.Nil(t, err)
+		_, err = c.Get(ctx, "foo")
+		assert.True(t, c.IsKeyNotFound(err))
+	})
+}
+
+func TestVersionedCache(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(time.Minute, 0, WithVersionTTL(time.Hour))
+
+	version, err := c.Version(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), version)
+
+	ok, err := c.SetIfVersion(ctx, "foo", version, []byte("v0"), 0)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	affected, err := c.Invalidate(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), affected)
+	_, err = c.Get(ctx, "foo")
+	assert.True(t, c.IsKeyNotFound(err))
+
+	// A write based on the generation read before invalidation is discarded
+	ok, err = c.SetIfVersion(ctx, "foo", version, []byte("stale"), 0)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, err = c.Get(ctx, "foo")
+	assert.True(t, c.IsKeyNotFound(err))
+
+	version, err = c.Version(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), version)
+	ok, err = c.SetIfVersion(ctx, "foo", version, []byte("v1"), 0)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestTaggedCache(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(time.Minute, 0)
+
+	assert.Nil(t, c.Tag(ctx, "tenant:1", time.Minute, "user:1", "user:2"))
+	assert.Nil(t, c.Tag(ctx, "tenant:1", time.Minute, "user:2", "user:3"))
+
+	keys, err := c.PopTag(ctx, "tenant:1")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"user:1", "user:2", "user:3"}, keys)
+
+	keys, err = c.PopTag(ctx, "tenant:1")
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+
+	// Expired keys are pruned and the index expires with its last entry
+	assert.Nil(t, c.Tag(ctx, "tenant:2", 10*time.Millisecond, "user:1", "user:2"))
+	time.Sleep(20 * time.Millisecond)
+	_, _, found := c.tags.GetWithExpiration("tenant:2")
+	assert.False(t, found)
+	assert.Nil(t, c.Tag(ctx, "tenant:2", 10*time.Millisecond, "user:1"))
+	assert.Nil(t, c.Tag(ctx, "tenant:2", time.Minute, "user:3"))
+	time.Sleep(20 * time.Millisecond)
+	assert.Nil(t, c.Tag(ctx, "tenant:2", time.Minute, "user:4"))
+	val, _ := c.tags.Get("tenant:2")
+	assert.Len(t, val, 2)
+	keys, err = c.PopTag(ctx, "tenant:2")
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"user:3", "user:4"}, keys)
+}
+
+func TestLocker(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(time.Minute, 0)
+
+	unlock, ok, err := c.TryLock(ctx, "user:1:lock", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	_, ok, err = c.TryLock(ctx, "user:1:lock", time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	assert.Nil(t, unlock(ctx))
+	_, ok, err = c.TryLock(ctx, "user:1:lock", time.Nanosecond)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// An expired lock can be taken over, and the stale unlock leaves it alone
+	time.Sleep(time.Millisecond)
+	_, ok, err = c.TryLock(ctx, "user:1:lock", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Nil(t, unlock(ctx))
+	_, ok, err = c.TryLock(ctx, "user:1:lock", time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestTTL(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(time.Minute, 0)
+
+	assert.Nil(t, c.Set(ctx, "short", []byte("v"), time.Second))
+	assert.Nil(t, c.Set(ctx, "default", []byte("v"), 0))
+	assert.Nil(t, c.Set(ctx, "never", []byte("v"), -1))
+	ttls, err := c.TTL(ctx, "short", "default", "never", "missing")
+	assert.Nil(t, err)
+	assert.InDelta(t, time.Second, ttls[0], float64(100*time.Millisecond))
+	assert.InDelta(t, time.Minute, ttls[1], float64(100*time.Millisecond))
+	assert.Equal(t, []time.Duration{0, 0}, ttls[2:])
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Observer receives events of the entity helpers, e.g. for metrics or logging.
+// Events are reported synchronously, so implementations should be fast and
+// must be safe for concurrent use. prefix is the entity (or unique key) key
+// prefix the event belongs to.
+type Observer interface {
+	// OnHit is called when key is served from cache, including tombstones and stale values
+	OnHit(ctx context.Context, prefix, key string)
+	// OnMiss is called when key is absent from cache or cannot be decoded
+	OnMiss(ctx context.Context, prefix, key string)
+	// OnLoad is called after each loader call with its duration and error
+	OnLoad(ctx context.Context, prefix string, duration time.Duration, err error)
+	// OnSetError is called when writing key to cache fails
+	OnSetError(ctx context.Context, prefix, key string, err error)
+	// OnDecodeError is called when cached data of key cannot be deserialized
+	// and the lookup falls through to the loader
+	OnDecodeError(ctx context.Context, prefix, key string, err error)
+}
+
+// WithObserver registers obs for the events of the entity helpers.
+// The option can be passed several times to register several observers.
+func WithObserver(obs Observer) func(*Client) {
+	return func(c *Client) {
+		c.observers = append(c.observers, obs)
+	}
+}
+
+// NopObserver implements Observer with no-op methods.
+// Embed it to implement only the events of interest.
+type NopObserver struct{}
+
+func (NopObserver) OnHit(ctx context.Context, prefix, key string) {}
+
+func (NopObserver) OnMiss(ctx context.Context, prefix, key string) {}
+
+func (NopObserver) OnLoad(ctx context.Context, prefix string, duration time.Duration, err error) {}
+
+func (NopObserver) OnSetError(ctx context.Context, prefix, key string, err error) {}
+
+func (NopObserver) OnDecodeError(ctx context.Context, prefix, key string, err error) {}
+
+// Stats is a snapshot of the events counted for one key prefix
+type Stats struct {
+	Hits         uint64
+	Misses       uint64
+	Loads        uint64
+	LoadErrors   uint64
+	LoadDuration time.Duration // Total duration of all loads
+	SetErrors    uint64
+	DecodeErrors uint64
+}
+
+// HitRatio returns the share of lookups served from cache, 0 without lookups
+func (s Stats) HitRatio() float64 {
+	if total := s.Hits + s.Misses; total > 0 {
+		return float64(s.Hits) / float64(total)
+	}
+	return 0
+}
+
+// AvgLoadDuration returns the average loader duration, 0 without loads
+func (s Stats) AvgLoadDuration() time.Duration {
+	if s.Loads > 0 {
+		return s.LoadDuration / time.Duration(s.Loads)
+	}
+	return 0
+}
+
+var _ Observer = (*StatsCounter)(nil) // Ensure StatsCounter implements Observer interface.
+
+// StatsCounter is an Observer counting events per key prefix
+type StatsCounter struct {
+	mu       sync.RWMutex
+	counters map[string]*counters
+}
+
+// counters holds the live counters of one key prefix
+type counters struct {
+	hits         atomic.Uint64
+	misses       atomic.Uint64
+	loads        atomic.Uint64
+	loadErrors   atomic.Uint64
+	loadDuration atomic.Int64
+	setErrors    atomic.Uint64
+	decodeErrors atomic.Uint64
+}
+
+// NewStatsCounter creates an empty stats counter
+func NewStatsCounter() *StatsCounter {
+	return &StatsCounter{
+		counters: make(map[string]*counters),
+	}
+}
+
+// of returns the counters of prefix, creating them on first use
+func (sc *StatsCounter) of(prefix string) *counters {
+	sc.mu.RLock()
+	cs, ok := sc.counters[prefix]
+	sc.mu.RUnlock()
+	if ok {
+		return cs
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if cs, ok = sc.counters[prefix]; !ok {
+		cs = new(counters)
+		sc.counters[prefix] = cs
+	}
+	return cs
+}
+
+func (sc *StatsCounter) OnHit(ctx context.Context, prefix, key string) {
+	sc.of(prefix).hits.Add(1)
+}
+
+func (sc *StatsCounter) OnMiss(ctx context.Context, prefix, key string) {
+	sc.of(prefix).misses.Add(1)
+}
+
+func (sc *StatsCounter) OnLoad(ctx context.Context, prefix string, duration time.Duration, err error) {
+	cs := sc.of(prefix)
+	cs.loads.Add(1)
+	cs.loadDuration.Add(int64(duration))
+	if err != nil {
+		cs.loadErrors.Add(1)
+	}
+}
+
+func (sc *StatsCounter) OnSetError(ctx context.Context, prefix, key string, err error) {
+	sc.of(prefix).setErrors.Add(1)
+}
+
+func (sc *StatsCounter) OnDecodeError(ctx context.Context, prefix, key string, err error) {
+	sc.of(prefix).decodeErrors.Add(1)
+}
+
+// Stats returns a snapshot of the stats of prefix
+func (sc *StatsCounter) Stats(prefix string) Stats {
+	sc.mu.RLock()
+	cs, ok := sc.counters[prefix]
+	sc.mu.RUnlock()
+	if !ok {
+		return Stats{}
+	}
+	return cs.snapshot()
+}
+
+// Snapshot returns a snapshot of the stats of every observed prefix
+func (sc *StatsCounter) Snapshot() map[string]Stats {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+
+	all := make(map[string]Stats, len(sc.counters))
+	for prefix, cs := range sc.counters {
+		all[prefix] = cs.snapshot()
+	}
+	return all
+}
+
+// Reset discards all counted events
+func (sc *StatsCounter) Reset() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.counters = make(map[string]*counters)
+}
+
+func (cs *counters) snapshot() Stats {
+	return Stats{
+		Hits:         cs.hits.Load(),
+		Misses:       cs.misses.Load(),
+		Loads:        cs.loads.Load(),
+		LoadErrors:   cs.loadErrors.Load(),
+		LoadDuration: time.Duration(cs.loadDuration.Load()),
+		SetErrors:    cs.setErrors.Load(),
+		DecodeErrors: cs.decodeErrors.Load(),
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsCounter(t *testing.T) {
+	ctx := context.Background()
+	cache := newMapCache()
+	stats := NewStatsCounter()
+	repo := NewRepository[user, uint64](NewClient(cache, WithObserver(stats)), "user")
+
+	load := func(ctx context.Context, id uint64) (*user, error) {
+		return &user{UID: id}, nil
+	}
+
+	for i := 0; i < 4; i++ {
+		_, err := repo.GetEntityByID(ctx, 1, load)
+		assert.Nil(t, err)
+	}
+
+	// Undecodable data falls through to the loader
+	assert.Nil(t, cache.Set(ctx, "user:2", []byte("{"), 0))
+	_, err := repo.GetEntityByID(ctx, 2, load)
+	assert.Nil(t, err)
+
+	errConn := errors.New("connection refused")
+	_, err = repo.GetEntityByID(ctx, 3, func(ctx context.Context, id uint64) (*user, error) {
+		return nil, errConn
+	})
+	assert.ErrorIs(t, err, errConn)
+
+	_, err = repo.GetEntitiesByIDs(ctx, []uint64{1, 4}, func(ctx context.Context, ids []uint64) (map[uint64]*user, error) {
+		return map[uint64]*user{4: {UID: 4}}, nil
+	})
+	assert.Nil(t, err)
+
+	s := stats.Stats("user")
+	assert.Equal(t, uint64(4), s.Hits)
+	assert.Equal(t, uint64(4), s.Misses)
+	assert.Equal(t, uint64(4), s.Loads)
+	assert.Equal(t, uint64(1), s.LoadErrors)
+	assert.Equal(t, uint64(1), s.DecodeErrors)
+	assert.Equal(t, uint64(0), s.SetErrors)
+	assert.Equal(t, 0.5, s.HitRatio())
+	assert.Equal(t, map[string]Stats{"user": s}, stats.Snapshot())
+
+	assert.Equal(t, Stats{}, stats.Stats("order"))
+	stats.Reset()
+	assert.Equal(t, 0, len(stats.Snapshot()))
+}
+
+func TestStats(t *testing.T) {
+	assert.Equal(t, float64(0), Stats{}.HitRatio())
+	assert.Equal(t, time.Duration(0), Stats{}.AvgLoadDuration())
+	assert.Equal(t, 0.75, Stats{Hits: 3, Misses: 1}.HitRatio())
+	assert.Equal(t, time.Second, Stats{Loads: 2, LoadDuration: 2 * time.Second}.AvgLoadDuration())
+}
+
+// missObserver counts misses only
+type missObserver struct {
+	NopObserver
+	misses []string
+}
+
+func (obs *missObserver) OnMiss(ctx context.Context, prefix, key string) {
+	obs.misses = append(obs.misses, key)
+}
+
+func TestNopObserver(t *testing.T) {
+	obs := new(missObserver)
+	repo := NewRepository[user, uint64](NewClient(newMapCache(), WithObserver(obs)), "user")
+	_, err := repo.GetEntityByID(context.Background(), 1, func(ctx context.Context, id uint64) (*user, error) {
+		return &user{UID: id}, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user:1"}, obs.misses)
+}
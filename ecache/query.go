@@ -0,0 +1,220 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/voidint/box/constraints"
+	"github.com/voidint/box/db"
+)
+
+// queryKeyPrefix prefixes the cache keys of query results
+const queryKeyPrefix = "query"
+
+// queryTagKeyPrefix prefixes the cache keys holding query tag versions
+const queryTagKeyPrefix = "query_tag"
+
+// DefaultQueryTagTTL is the default time-to-live of query tag versions
+const DefaultQueryTagTTL = 24 * time.Hour
+
+// WithQueryTagTTL sets the time-to-live of query tag versions written by
+// InvalidateQueryTags and InvalidateTag (<=0 uses DefaultQueryTagTTL).
+// Results of queries with tags are cached for at most ttl, so they never
+// outlive the versions they were cached under.
+func WithQueryTagTTL(ttl time.Duration) func(*Client) {
+	return func(c *Client) {
+		if ttl <= 0 {
+			ttl = DefaultQueryTagTTL
+		}
+		c.queryTagTTL = ttl
+	}
+}
+
+// Query identifies a cacheable query result, e.g. "top 20 products in
+// category X sorted by price". Queries with equal Name, Params, OrderBy
+// and Page share one cache entry.
+type Query[INT constraints.Unsigned] struct {
+	// Name distinguishes queries with similar parameters, e.g. "top_products"
+	Name string
+	// Params holds the query parameters, typically a struct.
+	// It is hashed through its JSON encoding, so it must be serializable.
+	Params any
+	// OrderBy holds the sort order of the result, may be nil
+	OrderBy db.OrderBy
+	// Page holds the pagination of the result, may be nil
+	Page *db.Page[INT]
+	// Tags group cached results for invalidation, e.g. "category:7".
+	// See Client.InvalidateTag and Client.InvalidateQueryTags.
+	Tags []string
+	// Expiration overrides the TTL of the client for this query when positive.
+	// With tags, the TTL is capped by WithQueryTagTTL.
+	Expiration time.Duration
+}
+
+// GetOrLoad returns the result of query from cache, or loads it with load
+// and caches it on a miss. Concurrent loads of the same query are
+// deduplicated with singleflight.
+//
+// The cache key is a stable hash of the query name, parameters, sort order,
+// pagination and the current versions of its tags. Invalidating a tag
+// therefore makes every result cached under it unreachable, leaving the
+// entries to expire with their TTL.
+func GetOrLoad[T any, INT constraints.Unsigned](
+	ctx context.Context,
+	c *Client,
+	query Query[INT],
+	load func(context.Context) (T, error),
+) (T, error) {
+	var result T
+
+	// 0. When cache is disabled, directly query database
+	if c.disabled {
+		result, err := load(ctx)
+		if err != nil {
+			return result, errors.WithStack(err)
+		}
+		return result, nil
+	}
+
+	// 1. Attempt to retrieve from cache first
+	key, err := queryKey(ctx, c, query)
+	if err != nil {
+		return result, err
+	}
+
+	data, err := c.cache.Get(ctx, key)
+	if err != nil && !c.cache.IsKeyNotFound(err) {
+		return result, errors.WithStack(err)
+	}
+	if err == nil {
+		if err = c.codec.Unmarshal(data, &result); err == nil {
+			c.onHit(ctx, query.Name, key)
+			return result, nil
+		}
+		// If deserialization fails, continue execution flow
+		c.onDecodeError(ctx, query.Name, key, err)
+	}
+	c.onMiss(ctx, query.Name, key)
+
+	// 2. Fallback to database query if cache miss
+	loaded, err := c.do(ctx, key, func(ctx context.Context) (any, error) {
+		start := time.Now()
+		result, err := load(ctx)
+		c.onLoad(ctx, query.Name, time.Since(start), err)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		// 3. Serialize and cache result for future requests
+		data, err := c.codec.Marshal(&result)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		expiration := c.expiration
+		if query.Expiration > 0 {
+			expiration = query.Expiration
+		}
+		ttl := c.ttl(expiration)
+		if len(query.Tags) > 0 && (ttl <= 0 || ttl > c.queryTagTTL) {
+			ttl = c.queryTagTTL // Expire before the tag versions revert to 0
+		}
+		if err = c.cache.Set(ctx, key, data, ttl); err != nil {
+			c.onSetError(ctx, query.Name, key, err)
+			return nil, errors.WithStack(err)
+		}
+		return result, nil
+	})
+	if err != nil {
+		return result, err
+	}
+	result, _ = loaded.(T) // A nil interface T stays the zero value
+	return result, nil
+}
+
+// InvalidateQueryTags makes every query result cached under any of tags
+// unreachable by bumping the tag versions. Unlike InvalidateTag, it leaves
+// the entities tagged with TaggedEntity cached.
+//
+// The versions expire after the TTL set by WithQueryTagTTL, so tags of
+// short-lived data do not accumulate in the cache. With an invalidation bus
+// configured, the version keys are broadcast, so other instances drop the
+// copies of the old versions from their in-process caches.
+func (c *Client) InvalidateQueryTags(ctx context.Context, tags ...string) error {
+	if c.disabled {
+		return nil
+	}
+	version := uint64(c.now().UnixNano())
+	keys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		key := c.Key(queryTagKeyPrefix, tag)
+		if err := c.cache.SetUint64(ctx, key, version, c.queryTagTTL); err != nil {
+			return errors.WithStack(err)
+		}
+		keys = append(keys, key)
+	}
+	if c.bus != nil && len(keys) > 0 {
+		if err := c.bus.Publish(ctx, keys...); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// queryKey builds the cache key of query from a hash of its components
+// and the current versions of its tags
+func queryKey[INT constraints.Unsigned](ctx context.Context, c *Client, query Query[INT]) (string, error) {
+	params, err := json.Marshal(query.Params)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	h := sha256.New()
+	writeField := func(b []byte) {
+		_ = binary.Write(h, binary.BigEndian, uint64(len(b))) // Length prefix keeps fields apart
+		_, _ = h.Write(b)
+	}
+	writeField(params)
+	writeField([]byte(query.OrderBy.String()))
+	if query.Page != nil {
+		writeField(binary.BigEndian.AppendUint64(
+			binary.BigEndian.AppendUint64(nil, uint64(query.Page.PageNo())),
+			uint64(query.Page.PageSize()),
+		))
+	} else {
+		writeField(nil)
+	}
+	for _, tag := range query.Tags {
+		version, err := c.cache.GetAsUint64(ctx, c.Key(queryTagKeyPrefix, tag))
+		if err != nil && !c.cache.IsKeyNotFound(err) {
+			return "", errors.WithStack(err)
+		}
+		writeField([]byte(tag))
+		writeField(binary.BigEndian.AppendUint64(nil, version))
+	}
+
+	return c.Key(queryKeyPrefix, query.Name, hex.EncodeToString(h.Sum(nil)[:16])), nil
+}
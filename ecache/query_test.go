@@ -0,0 +1,138 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/voidint/box/db"
+)
+
+func TestGetOrLoad(t *testing.T) {
+	ctx := context.Background()
+
+	type params struct {
+		Category uint64
+	}
+
+	var loads int
+	load := func(ctx context.Context) ([]user, error) {
+		loads++
+		return []user{{UID: 1, Name: "foo"}, {UID: 2, Name: "bar"}}, nil
+	}
+
+	cache := newMapCache()
+	c := NewClient(cache)
+	query := Query[uint64]{
+		Name:    "top_users",
+		Params:  params{Category: 7},
+		OrderBy: db.OneOrderBy("name", db.ASC),
+		Page:    db.NewPage[uint64](1, 20),
+		Tags:    []string{"category:7"},
+	}
+
+	users, err := GetOrLoad(ctx, c, query, load)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(users))
+	assert.Equal(t, 1, loads)
+
+	// Identical query is served from cache
+	users, err = GetOrLoad(ctx, c, query, load)
+	assert.Nil(t, err)
+	assert.Equal(t, "bar", users[1].Name)
+	assert.Equal(t, 1, loads)
+
+	// Different page or sort order is a different entry
+	other := query
+	other.Page = db.NewPage[uint64](2, 20)
+	_, err = GetOrLoad(ctx, c, other, load)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, loads)
+
+	other = query
+	other.OrderBy = db.OneOrderBy("name", db.DESC)
+	_, err = GetOrLoad(ctx, c, other, load)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, loads)
+
+	// Invalidating the tag forces a reload
+	assert.Nil(t, c.InvalidateQueryTags(ctx, "category:7"))
+	_, err = GetOrLoad(ctx, c, query, load)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, loads)
+	_, err = GetOrLoad(ctx, c, query, load)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, loads)
+
+	// Unrelated tags leave the entry alone
+	assert.Nil(t, c.InvalidateQueryTags(ctx, "category:8"))
+	_, err = GetOrLoad(ctx, c, query, load)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, loads)
+}
+
+func TestQueryTagTTL(t *testing.T) {
+	ctx := context.Background()
+	load := func(ctx context.Context) (int, error) {
+		return 1, nil
+	}
+
+	cache := newMapCache()
+	c := NewClient(cache, WithQueryTagTTL(time.Hour))
+
+	// Tag versions expire instead of accumulating
+	assert.Nil(t, c.InvalidateQueryTags(ctx, "user:1"))
+	assert.Equal(t, time.Hour, cache.expires["query_tag:user:1"])
+	_, err := NewClient(cache).InvalidateTag(ctx, "user:2")
+	assert.ErrorIs(t, err, ErrTagsUnsupported)
+	assert.Equal(t, DefaultQueryTagTTL, cache.expires["query_tag:user:2"])
+
+	// Tagged results do not outlive the versions they were cached under
+	for _, tc := range []struct {
+		query Query[uint64]
+		ttl   time.Duration
+	}{
+		{Query[uint64]{Name: "forever", Tags: []string{"user:1"}}, time.Hour},
+		{Query[uint64]{Name: "long", Tags: []string{"user:1"}, Expiration: 2 * time.Hour}, time.Hour},
+		{Query[uint64]{Name: "short", Tags: []string{"user:1"}, Expiration: time.Minute}, time.Minute},
+		{Query[uint64]{Name: "untagged", Expiration: 2 * time.Hour}, 2 * time.Hour},
+	} {
+		_, err = GetOrLoad(ctx, c, tc.query, load)
+		assert.Nil(t, err)
+		key, err := queryKey(ctx, c, tc.query)
+		assert.Nil(t, err)
+		assert.Equal(t, tc.ttl, cache.expires[key], tc.query.Name)
+	}
+}
+
+func TestGetOrLoadNilInterface(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient(newMapCache())
+
+	// A nil result of an interface type does not panic
+	result, err := GetOrLoad(ctx, c, Query[uint64]{Name: "nothing"}, func(ctx context.Context) (any, error) {
+		return nil, nil
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, result)
+}
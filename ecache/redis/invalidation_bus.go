@@ -0,0 +1,93 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package redis
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"github.com/voidint/box/ecache"
+)
+
+var _ ecache.InvalidationBus = (*invalidationBus)(nil) // Ensure invalidationBus implements ecache.InvalidationBus interface.
+
+// invalidationBus implements ecache.InvalidationBus on Redis pub/sub.
+// Deleted keys are published as a JSON array of strings on one channel.
+type invalidationBus struct {
+	rdb     redis.UniversalClient
+	channel string
+}
+
+// NewInvalidationBus creates a Redis pub/sub invalidation bus.
+// client: Configured go-redis client, e.g. *redis.Client or *redis.ClusterClient
+// channel: Pub/sub channel shared by every instance
+func NewInvalidationBus(client redis.UniversalClient, channel string) *invalidationBus {
+	return &invalidationBus{
+		rdb:     client,
+		channel: channel,
+	}
+}
+
+// Publish broadcasts keys with redis PUBLISH command.
+// Wraps redis PUBLISH command errors with stack trace.
+func (bus *invalidationBus) Publish(ctx context.Context, keys ...string) (err error) {
+	if len(keys) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(keys)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err = bus.rdb.Publish(ctx, bus.channel, payload).Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Subscribe listens on the channel and passes published keys to handler.
+// It returns once the subscription is confirmed by the server, handler is
+// then called from a dedicated goroutine until unsubscribe is called.
+// Malformed messages are ignored.
+func (bus *invalidationBus) Subscribe(ctx context.Context, handler func(keys []string)) (unsubscribe func() error, err error) {
+	pubsub := bus.rdb.Subscribe(ctx, bus.channel)
+	if _, err = pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	go func() {
+		for msg := range pubsub.Channel() {
+			var keys []string
+			if err := json.Unmarshal([]byte(msg.Payload), &keys); err != nil {
+				continue
+			}
+			handler(keys)
+		}
+	}()
+
+	return func() error {
+		if err := pubsub.Close(); err != nil {
+			return errors.WithStack(err)
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package redis
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrNoNamespace indicates PurgeNamespace was called on a cache without
+// namespace, which would delete every key
+var ErrNoNamespace = errors.New("cache has no namespace")
+
+// WithNamespace prefixes every key with namespace and ':', so services
+// sharing one Redis do not collide. Keys passed to and returned by the
+// cache are unprefixed. The namespace must not contain '{' or '}', which
+// would change the hash slots of keys in Redis Cluster.
+func WithNamespace(namespace string) func(*cache) {
+	return func(c *cache) {
+		if namespace != "" {
+			c.prefix = namespace + ":"
+		}
+	}
+}
+
+// PurgeNamespace deletes every key of the namespace, iterating with SCAN
+// rather than KEYS so Redis is not blocked. With Redis Cluster or a Ring,
+// every master or shard is scanned. scanCount hints the number of keys
+// examined per SCAN call (<=0 uses the batch size).
+// Keys written concurrently may survive the purge. Key generations of
+// versioned writes are left alone, they expire after the version TTL.
+// Returns number of deleted keys, or ErrNoNamespace without namespace.
+func (c *cache) PurgeNamespace(ctx context.Context, scanCount int64) (deleted int64, err error) {
+	if c.prefix == "" {
+		return 0, errors.WithStack(ErrNoNamespace)
+	}
+	if scanCount <= 0 {
+		scanCount = int64(max(c.batchSize, 1))
+	}
+	match := escapeGlob(c.prefix) + "*"
+
+	var total atomic.Int64
+	purge := func(ctx context.Context, node redis.Cmdable) error {
+		var cursor uint64
+		for {
+			keys, next, err := node.Scan(ctx, cursor, match, scanCount).Result()
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			n, err := c.del(ctx, keys)
+			total.Add(n)
+			if err != nil {
+				return err
+			}
+			if cursor = next; cursor == 0 {
+				return nil
+			}
+		}
+	}
+
+	switch rdb := c.rdb.(type) {
+	case *redis.ClusterClient:
+		err = rdb.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return purge(ctx, node)
+		})
+	case *redis.Ring:
+		err = rdb.ForEachShard(ctx, func(ctx context.Context, node *redis.Client) error {
+			return purge(ctx, node)
+		})
+	default:
+		err = purge(ctx, rdb)
+	}
+	if err != nil {
+		return total.Load(), errors.WithStack(err)
+	}
+	return total.Load(), nil
+}
+
+// key returns key within the namespace
+func (c *cache) key(key string) string {
+	return c.prefix + key
+}
+
+// keys returns keys within the namespace
+func (c *cache) keys(keys []string) []string {
+	if c.prefix == "" {
+		return keys
+	}
+	namespaced := make([]string, 0, len(keys))
+	for _, key := range keys {
+		namespaced = append(namespaced, c.key(key))
+	}
+	return namespaced
+}
+
+// escapeGlob escapes the glob-style pattern characters of SCAN MATCH in s
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
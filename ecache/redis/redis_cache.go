@@ -21,6 +21,9 @@ package redis
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -28,28 +31,101 @@ import (
 	"github.com/voidint/box/ecache"
 )
 
-var _ ecache.Cache = (*cache)(nil) // Ensure cache implements ecache.Cache interface.
+var (
+	_ ecache.Cache          = (*cache)(nil) // Ensure cache implements ecache.Cache interface.
+	_ ecache.VersionedCache = (*cache)(nil) // Ensure cache implements ecache.VersionedCache interface.
+	_ ecache.TaggedCache    = (*cache)(nil) // Ensure cache implements ecache.TaggedCache interface.
+	_ ecache.Locker         = (*cache)(nil) // Ensure cache implements ecache.Locker interface.
+	_ ecache.ExpiringCache  = (*cache)(nil) // Ensure cache implements ecache.ExpiringCache interface.
+)
+
+// DefaultVersionTTL is the default time-to-live of key generations
+const DefaultVersionTTL = time.Minute
+
+// WithVersionTTL sets how long a key generation is kept after invalidation.
+// It should exceed the longest loader duration: a loader outliving it may
+// write back data loaded before the invalidation.
+func WithVersionTTL(ttl time.Duration) func(*cache) {
+	return func(c *cache) {
+		c.versionTTL = ttl
+	}
+}
+
+// DefaultBatchSize is the default maximum number of keys per MGET or DEL command
+const DefaultBatchSize = 500
+
+// WithBatchSize sets the maximum number of keys per MGET or DEL command
+// (<=0 means no limit). Larger batches are split into several commands
+// sent in one pipeline, so they still take one round trip.
+func WithBatchSize(size int) func(*cache) {
+	return func(c *cache) {
+		c.batchSize = size
+	}
+}
+
+// Item is a value stored by MSetWithTTL with its own expiration
+type Item struct {
+	Val    []byte
+	Expire time.Duration // Time-to-live duration (<=0 means no expiration)
+}
 
 // cache implements Redis-based caching solution.
 // It wraps go-redis client to provide standard cache interface.
 type cache struct {
-	rdb *redis.Client
+	rdb        redis.UniversalClient
+	versionTTL time.Duration
+	batchSize  int
+	prefix     string // Namespace prefix of keys, empty without namespace
 }
 
 // NewCache creates a Redis cache instance.
-// client: Configured go-redis client connection
-func NewCache(client *redis.Client) *cache {
-	return &cache{
-		rdb: client,
+// client: Configured go-redis client, e.g. *redis.Client, *redis.ClusterClient
+// (Redis Cluster), a failover client (Redis Sentinel) or *redis.Ring
+func NewCache(client redis.UniversalClient, opts ...func(*cache)) *cache {
+	c := cache{
+		rdb:        client,
+		versionTTL: DefaultVersionTTL,
+		batchSize:  DefaultBatchSize,
 	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return &c
 }
 
-// Del removes multiple keys from cache.
+// Del removes multiple keys from cache with a single DEL command.
+// Keys spanning hash slots (Redis Cluster) or exceeding the batch size are
+// deleted with several DEL commands in one pipeline.
 // Returns number of deleted keys and any error encountered.
 // Wraps redis DEL command errors with stack trace.
 func (c *cache) Del(ctx context.Context, keys ...string) (affected int64, err error) {
-	if affected, err = c.rdb.Del(ctx, keys...).Result(); err != nil {
-		return affected, errors.WithStack(err)
+	return c.del(ctx, c.keys(keys))
+}
+
+// del removes multiple namespaced keys, see Del
+func (c *cache) del(ctx context.Context, keys []string) (affected int64, err error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	batches := c.batches(keys)
+	if len(batches) == 1 {
+		if affected, err = c.rdb.Del(ctx, keys...).Result(); err != nil {
+			return affected, errors.WithStack(err)
+		}
+		return affected, nil
+	}
+
+	cmds := make([]*redis.IntCmd, 0, len(batches))
+	if _, err = c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, batch := range batches {
+			cmds = append(cmds, pipe.Del(ctx, pick(keys, batch)...))
+		}
+		return nil
+	}); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	for _, cmd := range cmds {
+		affected += cmd.Val()
 	}
 	return affected, nil
 }
@@ -58,7 +134,7 @@ func (c *cache) Del(ctx context.Context, keys ...string) (affected int64, err er
 // Returns redis.Nil error when key does not exist.
 // Wraps underlying redis GET command errors.
 func (c *cache) Get(ctx context.Context, key string) (val []byte, err error) {
-	if val, err = c.rdb.Get(ctx, key).Bytes(); err != nil {
+	if val, err = c.rdb.Get(ctx, c.key(key)).Bytes(); err != nil {
 		return nil, errors.WithStack(err)
 	}
 	return val, nil
@@ -68,7 +144,7 @@ func (c *cache) Get(ctx context.Context, key string) (val []byte, err error) {
 // expire: Time-to-live duration (<=0 means no expiration)
 // Wraps redis SET command errors with stack trace.
 func (c *cache) Set(ctx context.Context, key string, val []byte, expire time.Duration) (err error) {
-	if err = c.rdb.Set(ctx, key, val, expire).Err(); err != nil {
+	if err = c.rdb.Set(ctx, c.key(key), val, expire).Err(); err != nil {
 		return errors.WithStack(err)
 	}
 	return nil
@@ -78,7 +154,7 @@ func (c *cache) Set(ctx context.Context, key string, val []byte, expire time.Dur
 // Returns 0 and error if value cannot be converted.
 // Wraps underlying redis GET command errors.
 func (c *cache) GetAsUint64(ctx context.Context, key string) (val uint64, err error) {
-	if val, err = c.rdb.Get(ctx, key).Uint64(); err != nil {
+	if val, err = c.rdb.Get(ctx, c.key(key)).Uint64(); err != nil {
 		return 0, errors.WithStack(err)
 	}
 	return val, nil
@@ -88,12 +164,355 @@ func (c *cache) GetAsUint64(ctx context.Context, key string) (val uint64, err er
 // expire: Time-to-live duration (<=0 means no expiration)
 // Wraps redis SET command errors with stack trace.
 func (c *cache) SetUint64(ctx context.Context, key string, val uint64, expire time.Duration) (err error) {
-	if err = c.rdb.Set(ctx, key, val, expire).Err(); err != nil {
+	if err = c.rdb.Set(ctx, c.key(key), val, expire).Err(); err != nil {
 		return errors.WithStack(err)
 	}
 	return nil
 }
 
+// MGet retrieves byte slice values for given keys with a single MGET command.
+// Keys spanning hash slots (Redis Cluster) or exceeding the batch size are
+// read with several MGET commands in one pipeline.
+// Returned values are aligned with keys: missing keys yield nil elements,
+// stored empty values yield empty non-nil elements.
+// Wraps underlying redis MGET command errors.
+func (c *cache) MGet(ctx context.Context, keys ...string) (vals [][]byte, err error) {
+	if len(keys) == 0 {
+		return [][]byte{}, nil
+	}
+	keys = c.keys(keys)
+	batches := c.batches(keys)
+	cmds := make([]*redis.SliceCmd, 0, len(batches))
+	if len(batches) == 1 {
+		cmds = append(cmds, c.rdb.MGet(ctx, keys...))
+	} else if _, err = c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, batch := range batches {
+			cmds = append(cmds, pipe.MGet(ctx, pick(keys, batch)...))
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	vals = make([][]byte, len(keys))
+	for b, cmd := range cmds {
+		results, err := cmd.Result()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for j, result := range results {
+			if str, ok := result.(string); ok {
+				vals[batches[b][j]] = append([]byte{}, str...)
+			}
+		}
+	}
+	return vals, nil
+}
+
+// Missed returns the keys missing from vals, as returned by MGet for keys
+func Missed(keys []string, vals [][]byte) []string {
+	missed := make([]string, 0, len(keys))
+	for i := range keys {
+		if vals[i] == nil {
+			missed = append(missed, keys[i])
+		}
+	}
+	return missed
+}
+
+// pick returns the keys at indexes
+func pick(keys []string, indexes []int) []string {
+	picked := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		picked = append(picked, keys[i])
+	}
+	return picked
+}
+
+// MSet stores multiple values with the same TTL expiration in one pipeline.
+// expire: Time-to-live duration (<=0 means no expiration)
+// Wraps redis SET command errors with stack trace.
+func (c *cache) MSet(ctx context.Context, items map[string][]byte, expire time.Duration) (err error) {
+	if len(items) == 0 {
+		return nil
+	}
+	if _, err = c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, val := range items {
+			pipe.Set(ctx, c.key(key), val, expire)
+		}
+		return nil
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// MSetWithTTL stores multiple values, each with its own TTL expiration,
+// in one pipeline.
+// Wraps redis SET command errors with stack trace.
+func (c *cache) MSetWithTTL(ctx context.Context, items map[string]Item) (err error) {
+	if len(items) == 0 {
+		return nil
+	}
+	if _, err = c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, item := range items {
+			pipe.Set(ctx, c.key(key), item.Val, max(item.Expire, 0)) // -1 would keep the current TTL
+		}
+		return nil
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// TTL retrieves the remaining time-to-live of keys with PTTL commands in
+// one pipeline.
+// Returns 0 for keys without expiration and for missing keys.
+// Wraps redis PTTL command errors with stack trace.
+func (c *cache) TTL(ctx context.Context, keys ...string) (ttls []time.Duration, err error) {
+	if len(keys) == 0 {
+		return []time.Duration{}, nil
+	}
+	cmds := make([]*redis.DurationCmd, 0, len(keys))
+	if _, err = c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			cmds = append(cmds, pipe.PTTL(ctx, c.key(key)))
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	ttls = make([]time.Duration, len(keys))
+	for i, cmd := range cmds {
+		ttls[i] = max(cmd.Val(), 0) // -1 without expiration, -2 for missing keys
+	}
+	return ttls, nil
+}
+
+// setIfVersionScript sets KEYS[1] to ARGV[2] with ARGV[3] milliseconds TTL
+// (<=0 means no expiration) if generation KEYS[2] equals ARGV[1].
+var setIfVersionScript = redis.NewScript(`
+if (redis.call('GET', KEYS[2]) or '0') ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+else
+	redis.call('SET', KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// invalidateScript deletes KEYS[1] and bumps generation KEYS[2], which
+// expires after ARGV[1] milliseconds.
+var invalidateScript = redis.NewScript(`
+redis.call('INCR', KEYS[2])
+redis.call('PEXPIRE', KEYS[2], ARGV[1])
+return redis.call('DEL', KEYS[1])
+`)
+
+// versionKey returns the key holding the generation of key.
+// It shares the hash slot of key, so scripts touching both keys also work
+// with Redis Cluster.
+func versionKey(key string) string {
+	if hashTag(key) != key {
+		return key + ":version" // Hash tag of key is kept
+	}
+	return "{" + key + "}:version"
+}
+
+// milliseconds converts d to milliseconds for scripts.
+// Positive durations below one millisecond are rounded up to keep a TTL.
+func milliseconds(d time.Duration) int64 {
+	if ms := d.Milliseconds(); ms > 0 || d <= 0 {
+		return ms
+	}
+	return 1
+}
+
+// Version retrieves the current generation of key.
+// Returns 0 if key was never invalidated or its generation expired.
+// Wraps underlying redis GET command errors.
+func (c *cache) Version(ctx context.Context, key string) (version uint64, err error) {
+	if version, err = c.rdb.Get(ctx, versionKey(c.key(key))).Uint64(); err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+		return 0, errors.WithStack(err)
+	}
+	return version, nil
+}
+
+// SetIfVersion atomically stores value with TTL expiration if the
+// generation of key still equals version.
+// expire: Time-to-live duration (<=0 means no expiration)
+// Wraps redis script errors with stack trace.
+func (c *cache) SetIfVersion(ctx context.Context, key string, version uint64, val []byte, expire time.Duration) (ok bool, err error) {
+	n, err := setIfVersionScript.Run(ctx, c.rdb,
+		[]string{c.key(key), versionKey(c.key(key))},
+		version, val, milliseconds(expire),
+	).Int()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return n == 1, nil
+}
+
+// Invalidate atomically deletes each key and bumps its generation, with
+// one script call per key in one pipeline.
+// Returns number of deleted keys and any error encountered.
+// Wraps redis script errors with stack trace.
+func (c *cache) Invalidate(ctx context.Context, keys ...string) (affected int64, err error) {
+	keys = c.keys(keys)
+	scriptKeys := make([][]string, 0, len(keys))
+	for _, key := range keys {
+		scriptKeys = append(scriptKeys, []string{key, versionKey(key)})
+	}
+	cmds, err := c.runScripts(ctx, invalidateScript, scriptKeys, milliseconds(c.versionTTL))
+	for _, cmd := range cmds {
+		n, _ := cmd.Int64()
+		affected += n
+	}
+	return affected, err
+}
+
+// runScripts runs script once per element of keys in one pipeline. Calls
+// failing because the script is not loaded on their node are run again
+// with the script source, in a second pipeline.
+// Returns the commands aligned with keys, along with the first error.
+func (c *cache) runScripts(ctx context.Context, script *redis.Script, keys [][]string, args ...any) ([]*redis.Cmd, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	cmds := make([]*redis.Cmd, len(keys))
+	run := func(indexes []int, eval func(pipe redis.Pipeliner, keys []string) *redis.Cmd) {
+		// Errors are checked per command, as some of them are retried
+		_, _ = c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, i := range indexes {
+				cmds[i] = eval(pipe, keys[i])
+			}
+			return nil
+		})
+	}
+
+	all := make([]int, len(keys))
+	for i := range all {
+		all[i] = i
+	}
+	run(all, func(pipe redis.Pipeliner, keys []string) *redis.Cmd {
+		return script.EvalSha(ctx, pipe, keys, args...)
+	})
+	var missing []int
+	for i, cmd := range cmds {
+		if redis.HasErrorPrefix(cmd.Err(), "NOSCRIPT") {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) > 0 {
+		run(missing, func(pipe redis.Pipeliner, keys []string) *redis.Cmd {
+			return script.Eval(ctx, pipe, keys, args...)
+		})
+	}
+
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			return cmds, errors.WithStack(err)
+		}
+	}
+	return cmds, nil
+}
+
+// tagScript adds ARGV[2..] to set KEYS[1] and extends its TTL to at least
+// ARGV[1] milliseconds (<=0 means no expiration).
+var tagScript = redis.NewScript(`
+local existed = redis.call('EXISTS', KEYS[1])
+redis.call('SADD', KEYS[1], unpack(ARGV, 2))
+local ttl = tonumber(ARGV[1])
+if ttl <= 0 then
+	redis.call('PERSIST', KEYS[1])
+elseif existed == 0 then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+else
+	local current = redis.call('PTTL', KEYS[1])
+	if current >= 0 and current < ttl then
+		redis.call('PEXPIRE', KEYS[1], ttl)
+	end
+end
+return 1
+`)
+
+// Tag adds keys to the Redis set of tag, which expires with the longest
+// lived entry added to it.
+// expire: Time-to-live duration of the entries (<=0 means no expiration)
+// Wraps redis script errors with stack trace.
+func (c *cache) Tag(ctx context.Context, tag string, expire time.Duration, keys ...string) (err error) {
+	if len(keys) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(keys)+1)
+	args = append(args, milliseconds(expire))
+	for _, key := range keys {
+		args = append(args, c.key(key))
+	}
+	if err = tagScript.Run(ctx, c.rdb, []string{c.key(tag)}, args...).Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// PopTag atomically retrieves and deletes the Redis set of tag.
+// Returns an empty slice for unknown tags.
+// Wraps redis SMEMBERS and DEL command errors with stack trace.
+func (c *cache) PopTag(ctx context.Context, tag string) (keys []string, err error) {
+	var members *redis.StringSliceCmd
+	if _, err = c.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		members = pipe.SMembers(ctx, c.key(tag))
+		pipe.Del(ctx, c.key(tag))
+		return nil
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	keys = members.Val()
+	for i := range keys {
+		keys[i] = strings.TrimPrefix(keys[i], c.prefix)
+	}
+	return keys, nil
+}
+
+// unlockScript deletes lock KEYS[1] if it still holds token ARGV[1]
+var unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// TryLock acquires lock key for ttl with SET NX PX and a random token.
+// unlock deletes the lock only while it holds the token, so a lock that
+// expired and was taken over is left alone.
+// Wraps redis SET command and script errors with stack trace.
+func (c *cache) TryLock(ctx context.Context, key string, ttl time.Duration) (unlock func(context.Context) error, ok bool, err error) {
+	var buf [16]byte
+	if _, err = rand.Read(buf[:]); err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	token := hex.EncodeToString(buf[:])
+	key = c.key(key)
+
+	if ok, err = c.rdb.SetNX(ctx, key, token, ttl).Result(); err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	return func(ctx context.Context) error {
+		if err := unlockScript.Run(ctx, c.rdb, []string{key}, token).Err(); err != nil {
+			return errors.WithStack(err)
+		}
+		return nil
+	}, true, nil
+}
+
 // IsKeyNotFound checks if error represents missing key.
 // Returns true if error is redis.Nil.
 func (c *cache) IsKeyNotFound(err error) bool {
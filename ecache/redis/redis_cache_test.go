@@ -0,0 +1,344 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package redis
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/voidint/box/ecache"
+	"github.com/voidint/box/ecache/redis/redistest"
+)
+
+// SHA1 digests of the script sources the Go ports of newServer were
+// written for. The fake server cannot run Lua, so tests cover the ports
+// only; TestScriptPorts fails when a script changes without its port.
+const (
+	setIfVersionScriptHash = "c06a355808cb9d95398a7cf7fcc2929575eab844"
+	invalidateScriptHash   = "c7e77dc024d5a65cf372ce24b7cc900c272e0a55"
+	tagScriptHash          = "bec0ad96a540715ceda37ab25c595c26e06b420c"
+	unlockScriptHash       = "4130e6fa85cd247cdb50bd65e8e82d96e47cacd1"
+)
+
+func TestScriptPorts(t *testing.T) {
+	msg := "script changed, update its Go port in newServer and the pinned hash"
+	assert.Equal(t, setIfVersionScriptHash, setIfVersionScript.Hash(), msg)
+	assert.Equal(t, invalidateScriptHash, invalidateScript.Hash(), msg)
+	assert.Equal(t, tagScriptHash, tagScript.Hash(), msg)
+	assert.Equal(t, unlockScriptHash, unlockScript.Hash(), msg)
+}
+
+// newServer starts a fake server serving Go ports of the scripts of the backend
+func newServer(t *testing.T) (*redistest.Server, *redis.Client) {
+	s, err := redistest.NewServer()
+	assert.Nil(t, err)
+	rdb := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() {
+		_ = rdb.Close()
+		_ = s.Close()
+	})
+
+	// Go ports of the Lua scripts
+	s.HandleScript(setIfVersionScriptHash, func(call func(args ...any) (any, error), keys, args []string) (any, error) {
+		version, err := call("GET", keys[1])
+		if err != nil {
+			return nil, err
+		}
+		if version == nil {
+			version = "0"
+		}
+		if version != args[0] {
+			return 0, nil
+		}
+		if ttl, _ := strconv.ParseInt(args[2], 10, 64); ttl > 0 {
+			_, err = call("SET", keys[0], args[1], "PX", args[2])
+		} else {
+			_, err = call("SET", keys[0], args[1])
+		}
+		if err != nil {
+			return nil, err
+		}
+		return 1, nil
+	})
+	s.HandleScript(invalidateScriptHash, func(call func(args ...any) (any, error), keys, args []string) (any, error) {
+		if _, err := call("INCR", keys[1]); err != nil {
+			return nil, err
+		}
+		if _, err := call("PEXPIRE", keys[1], args[0]); err != nil {
+			return nil, err
+		}
+		return call("DEL", keys[0])
+	})
+	s.HandleScript(tagScriptHash, func(call func(args ...any) (any, error), keys, args []string) (any, error) {
+		existed, err := call("EXISTS", keys[0])
+		if err != nil {
+			return nil, err
+		}
+		members := make([]any, 0, len(args))
+		for _, member := range args[1:] {
+			members = append(members, member)
+		}
+		if _, err = call(append([]any{"SADD", keys[0]}, members...)...); err != nil {
+			return nil, err
+		}
+		ttl, _ := strconv.ParseInt(args[0], 10, 64)
+		switch {
+		case ttl <= 0:
+			_, err = call("PERSIST", keys[0])
+		case existed == int64(0):
+			_, err = call("PEXPIRE", keys[0], ttl)
+		default:
+			var current any
+			if current, err = call("PTTL", keys[0]); err == nil && current.(int64) >= 0 && current.(int64) < ttl {
+				_, err = call("PEXPIRE", keys[0], ttl)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return 1, nil
+	})
+	s.HandleScript(unlockScriptHash, func(call func(args ...any) (any, error), keys, args []string) (any, error) {
+		token, err := call("GET", keys[0])
+		if err != nil || token != args[0] {
+			return 0, err
+		}
+		return call("DEL", keys[0])
+	})
+	return s, rdb
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	s, rdb := newServer(t)
+	c := NewCache(rdb, WithBatchSize(2))
+
+	_, err := c.Get(ctx, "foo")
+	assert.True(t, c.IsKeyNotFound(err))
+
+	assert.Nil(t, c.Set(ctx, "foo", []byte("bar"), time.Minute))
+	val, err := c.Get(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bar"), val)
+
+	assert.Nil(t, c.SetUint64(ctx, "id", 42, 0))
+	id, err := c.GetAsUint64(ctx, "id")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(42), id)
+
+	// Batches span several MGET commands in one pipeline
+	assert.Nil(t, c.MSet(ctx, map[string][]byte{"a": []byte("1"), "b": {}}, 0))
+	vals, err := c.MGet(ctx, "a", "missing", "b", "foo", "id")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("1"), nil, {}, []byte("bar"), []byte("42")}, vals)
+	assert.Equal(t, []string{"missing"}, Missed([]string{"a", "missing", "b", "foo", "id"}, vals))
+
+	assert.Nil(t, c.MSetWithTTL(ctx, map[string]Item{
+		"short": {Val: []byte("s"), Expire: time.Second},
+		"long":  {Val: []byte("l"), Expire: time.Hour},
+		"never": {Val: []byte("n"), Expire: -1},
+	}))
+	s.FastForward(2 * time.Second)
+	vals, err = c.MGet(ctx, "short", "long", "never")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{nil, []byte("l"), []byte("n")}, vals)
+
+	ttls, err := c.TTL(ctx, "long", "never", "short")
+	assert.Nil(t, err)
+	assert.InDelta(t, time.Hour-2*time.Second, ttls[0], float64(time.Second))
+	assert.Equal(t, []time.Duration{0, 0}, ttls[1:])
+
+	affected, err := c.Del(ctx, "a", "b", "foo", "missing")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), affected)
+	assert.Equal(t, []string{"id", "long", "never"}, s.Keys())
+}
+
+func TestVersionedCache(t *testing.T) {
+	ctx := context.Background()
+	_, rdb := newServer(t)
+	c := NewCache(rdb, WithVersionTTL(time.Hour))
+
+	version, err := c.Version(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), version)
+
+	ok, err := c.SetIfVersion(ctx, "foo", version, []byte("v0"), time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	affected, err := c.Invalidate(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), affected)
+
+	// A write based on the generation read before invalidation is discarded
+	ok, err = c.SetIfVersion(ctx, "foo", version, []byte("stale"), 0)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, err = c.Get(ctx, "foo")
+	assert.True(t, c.IsKeyNotFound(err))
+
+	version, err = c.Version(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), version)
+	ttl, err := rdb.PTTL(ctx, versionKey("foo")).Result()
+	assert.Nil(t, err)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+
+	// Several keys are invalidated in one pipeline
+	assert.Nil(t, c.MSet(ctx, map[string][]byte{"a": []byte("1"), "b": []byte("2")}, 0))
+	affected, err = c.Invalidate(ctx, "a", "b", "missing")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), affected)
+	for _, key := range []string{"a", "b", "missing"} {
+		version, err = c.Version(ctx, key)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), version)
+	}
+}
+
+func TestTaggedCache(t *testing.T) {
+	ctx := context.Background()
+	_, rdb := newServer(t)
+	c := NewCache(rdb, WithNamespace("svc"))
+
+	assert.Nil(t, c.Tag(ctx, "tag:tenant:1", time.Minute, "user:1", "user:2"))
+	assert.Nil(t, c.Tag(ctx, "tag:tenant:1", time.Hour, "user:3"))
+	ttl, err := rdb.PTTL(ctx, "svc:tag:tenant:1").Result()
+	assert.Nil(t, err)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+
+	keys, err := c.PopTag(ctx, "tag:tenant:1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user:1", "user:2", "user:3"}, keys)
+	keys, err = c.PopTag(ctx, "tag:tenant:1")
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestLocker(t *testing.T) {
+	ctx := context.Background()
+	s, rdb := newServer(t)
+	c := NewCache(rdb)
+
+	unlock, ok, err := c.TryLock(ctx, "user:1:lock", time.Second)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	_, ok, err = c.TryLock(ctx, "user:1:lock", time.Second)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// The lock expired and was taken over, the stale unlock leaves it alone
+	s.FastForward(time.Second)
+	_, ok, err = c.TryLock(ctx, "user:1:lock", time.Second)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Nil(t, unlock(ctx))
+	_, ok, err = c.TryLock(ctx, "user:1:lock", time.Second)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestNamespacePurge(t *testing.T) {
+	ctx := context.Background()
+	s, rdb := newServer(t)
+	billing := NewCache(rdb, WithNamespace("billing"))
+	users := NewCache(rdb, WithNamespace("users"))
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, billing.Set(ctx, "invoice:"+strconv.Itoa(i), []byte("v"), 0))
+	}
+	assert.Nil(t, users.Set(ctx, "invoice:1", []byte("u"), 0))
+	val, err := billing.Get(ctx, "invoice:1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), val)
+
+	deleted, err := billing.PurgeNamespace(ctx, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), deleted)
+	assert.Equal(t, []string{"users:invoice:1"}, s.Keys())
+}
+
+func TestInvalidationBus(t *testing.T) {
+	ctx := context.Background()
+	_, rdb := newServer(t)
+	bus := NewInvalidationBus(rdb, "invalidations")
+
+	received := make(chan []string, 1)
+	unsubscribe, err := bus.Subscribe(ctx, func(keys []string) {
+		received <- keys
+	})
+	assert.Nil(t, err)
+	defer unsubscribe()
+
+	assert.Nil(t, bus.Publish(ctx, "user:1", "user:2"))
+	select {
+	case keys := <-received:
+		assert.Equal(t, []string{"user:1", "user:2"}, keys)
+	case <-time.After(time.Second):
+		t.Fatal("keys not delivered")
+	}
+}
+
+type user struct {
+	UID  uint64 `json:"id"`
+	Name string `json:"name"`
+}
+
+func (u user) ID() uint64 {
+	return u.UID
+}
+
+func TestEntityHelpers(t *testing.T) {
+	ctx := context.Background()
+	_, rdb := newServer(t)
+	client := ecache.NewClient(NewCache(rdb), ecache.WithVersionedWrites(true), ecache.WithExpiration(time.Minute))
+	repo := ecache.NewRepository[user, uint64](client, "user")
+
+	var loads int
+	load := func(ctx context.Context, id uint64) (*user, error) {
+		loads++
+		return &user{UID: id, Name: "foo"}, nil
+	}
+	for i := 0; i < 2; i++ {
+		one, err := repo.GetEntityByID(ctx, 1, load)
+		assert.Nil(t, err)
+		assert.Equal(t, "foo", one.Name)
+	}
+	assert.Equal(t, 1, loads)
+
+	users, err := repo.GetEntitiesByIDs(ctx, []uint64{1, 2}, func(ctx context.Context, ids []uint64) (map[uint64]*user, error) {
+		assert.Equal(t, []uint64{2}, ids)
+		return map[uint64]*user{2: {UID: 2, Name: "bar"}}, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "bar", users[1].Name)
+
+	affected, err := repo.DelCachedEntity(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), affected)
+	_, err = repo.GetEntityByID(ctx, 1, load)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, loads)
+}
@@ -0,0 +1,474 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package redistest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const wrongType = errorReply("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// exec runs a data command and returns its reply. Must be called with mu held.
+func (s *Server) exec(args []string) any {
+	name := strings.ToUpper(args[0])
+	args = args[1:]
+
+	// Minimum number of arguments of each command
+	arity := map[string]int{
+		"GET": 1, "SET": 2, "SETNX": 2, "DEL": 1, "UNLINK": 1, "MGET": 1, "EXISTS": 1,
+		"EXPIRE": 2, "PEXPIRE": 2, "TTL": 1, "PTTL": 1, "PERSIST": 1, "INCR": 1,
+		"SADD": 2, "SMEMBERS": 1, "SCARD": 1, "SCAN": 1,
+		"EVAL": 2, "EVALSHA": 2, "SCRIPT": 1,
+	}
+	if n, ok := arity[name]; ok && len(args) < n {
+		return wrongArgs(name)
+	}
+
+	switch name {
+	case "PING":
+		if len(args) > 0 {
+			return args[0]
+		}
+		return status("PONG")
+	case "CLIENT", "SELECT":
+		return status("OK")
+	case "FLUSHALL", "FLUSHDB":
+		s.data = make(map[string]*entry)
+		return status("OK")
+	case "DBSIZE":
+		return int64(len(s.keys()))
+	case "GET":
+		e := s.get(args[0])
+		if e == nil {
+			return nil
+		}
+		if e.set != nil {
+			return wrongType
+		}
+		return e.str
+	case "SET":
+		return s.set(args)
+	case "SETNX":
+		if s.get(args[0]) != nil {
+			return int64(0)
+		}
+		s.data[args[0]] = &entry{str: args[1]}
+		return int64(1)
+	case "DEL", "UNLINK":
+		var n int64
+		for _, key := range args {
+			if s.get(key) != nil {
+				delete(s.data, key)
+				n++
+			}
+		}
+		return n
+	case "MGET":
+		vals := make([]any, 0, len(args))
+		for _, key := range args {
+			if e := s.get(key); e != nil && e.set == nil {
+				vals = append(vals, e.str)
+			} else {
+				vals = append(vals, nil)
+			}
+		}
+		return vals
+	case "EXISTS":
+		var n int64
+		for _, key := range args {
+			if s.get(key) != nil {
+				n++
+			}
+		}
+		return n
+	case "EXPIRE", "PEXPIRE":
+		ttl, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errorReply("ERR value is not an integer or out of range")
+		}
+		unit := time.Second
+		if name == "PEXPIRE" {
+			unit = time.Millisecond
+		}
+		e := s.get(args[0])
+		if e == nil {
+			return int64(0)
+		}
+		if ttl <= 0 {
+			delete(s.data, args[0])
+		} else {
+			e.expires = s.now().Add(time.Duration(ttl) * unit)
+		}
+		return int64(1)
+	case "TTL", "PTTL":
+		e := s.get(args[0])
+		switch {
+		case e == nil:
+			return int64(-2)
+		case e.expires.IsZero():
+			return int64(-1)
+		case name == "TTL":
+			return int64((e.expires.Sub(s.now()) + time.Second/2) / time.Second)
+		}
+		return e.expires.Sub(s.now()).Milliseconds()
+	case "PERSIST":
+		e := s.get(args[0])
+		if e == nil || e.expires.IsZero() {
+			return int64(0)
+		}
+		e.expires = time.Time{}
+		return int64(1)
+	case "INCR":
+		e := s.get(args[0])
+		if e == nil {
+			e = &entry{str: "0"}
+			s.data[args[0]] = e
+		}
+		if e.set != nil {
+			return wrongType
+		}
+		n, err := strconv.ParseInt(e.str, 10, 64)
+		if err != nil {
+			return errorReply("ERR value is not an integer or out of range")
+		}
+		e.str = strconv.FormatInt(n+1, 10)
+		return n + 1
+	case "SADD":
+		e := s.get(args[0])
+		if e == nil {
+			e = &entry{set: make(map[string]struct{})}
+			s.data[args[0]] = e
+		}
+		if e.set == nil {
+			return wrongType
+		}
+		var n int64
+		for _, member := range args[1:] {
+			if _, ok := e.set[member]; !ok {
+				e.set[member] = struct{}{}
+				n++
+			}
+		}
+		return n
+	case "SMEMBERS":
+		e := s.get(args[0])
+		if e == nil {
+			return []any{}
+		}
+		if e.set == nil {
+			return wrongType
+		}
+		members := make([]string, 0, len(e.set))
+		for member := range e.set {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+		return strings2any(members)
+	case "SCARD":
+		e := s.get(args[0])
+		if e != nil && e.set == nil {
+			return wrongType
+		}
+		if e == nil {
+			return int64(0)
+		}
+		return int64(len(e.set))
+	case "SCAN":
+		return s.scan(args)
+	case "EVAL":
+		sha := sha1Hex(args[0])
+		s.loaded[sha] = struct{}{}
+		return s.eval(sha, args[1:])
+	case "EVALSHA":
+		sha := strings.ToLower(args[0])
+		if _, ok := s.loaded[sha]; !ok {
+			return errorReply("NOSCRIPT No matching script. Please use EVAL.")
+		}
+		return s.eval(sha, args[1:])
+	case "SCRIPT":
+		switch strings.ToUpper(args[0]) {
+		case "LOAD":
+			if len(args) != 2 {
+				return wrongArgs("SCRIPT|LOAD")
+			}
+			sha := sha1Hex(args[1])
+			s.loaded[sha] = struct{}{}
+			return sha
+		case "EXISTS":
+			exists := make([]any, 0, len(args)-1)
+			for _, sha := range args[1:] {
+				if _, ok := s.loaded[strings.ToLower(sha)]; ok {
+					exists = append(exists, int64(1))
+				} else {
+					exists = append(exists, int64(0))
+				}
+			}
+			return exists
+		case "FLUSH":
+			s.loaded = make(map[string]struct{})
+			return status("OK")
+		}
+	}
+	return errorReply(fmt.Sprintf("ERR unknown command '%s'", strings.ToLower(name)))
+}
+
+// set implements SET key value [EX seconds|PX milliseconds|KEEPTTL] [NX|XX]
+func (s *Server) set(args []string) any {
+	key, val := args[0], args[1]
+	var ttl time.Duration
+	var nx, xx, keepTTL bool
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX":
+			if i++; i >= len(args) {
+				return errorReply("ERR syntax error")
+			}
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				return errorReply("ERR value is not an integer or out of range")
+			}
+			if n <= 0 {
+				return errorReply("ERR invalid expire time in 'set' command")
+			}
+			if ttl = time.Duration(n) * time.Millisecond; opt == "EX" {
+				ttl = time.Duration(n) * time.Second
+			}
+		default:
+			return errorReply("ERR syntax error")
+		}
+	}
+
+	current := s.get(key)
+	if (nx && current != nil) || (xx && current == nil) {
+		return nil
+	}
+	e := entry{str: val}
+	if ttl > 0 {
+		e.expires = s.now().Add(ttl)
+	} else if keepTTL && current != nil {
+		e.expires = current.expires
+	}
+	s.data[key] = &e
+	return status("OK")
+}
+
+// scan implements SCAN cursor [MATCH pattern] [COUNT count] over the
+// sorted live keys, the cursor being an offset into them
+func (s *Server) scan(args []string) any {
+	cursor, err := strconv.Atoi(args[0])
+	if err != nil || cursor < 0 {
+		return errorReply("ERR invalid cursor")
+	}
+	pattern, count := "*", 10
+	for i := 1; i+1 < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count <= 0 {
+				return errorReply("ERR syntax error")
+			}
+		default:
+			return errorReply("ERR syntax error")
+		}
+	}
+
+	// Cursors resume after the last key returned rather than at an index,
+	// so keys deleted mid-iteration do not make SCAN skip the survivors
+	keys := s.keys()
+	start := 0
+	if cursor > 0 {
+		if cursor > len(s.cursors) {
+			return errorReply("ERR invalid cursor")
+		}
+		start = sort.SearchStrings(keys, s.cursors[cursor-1])
+		if start < len(keys) && keys[start] == s.cursors[cursor-1] {
+			start++
+		}
+	}
+	end := min(start+count, len(keys))
+	matched := make([]string, 0, count)
+	for _, key := range keys[start:end] {
+		if match(pattern, key) {
+			matched = append(matched, key)
+		}
+	}
+	next := 0
+	if end < len(keys) {
+		s.cursors = append(s.cursors, keys[end-1])
+		next = len(s.cursors)
+	}
+	return []any{strconv.Itoa(next), strings2any(matched)}
+}
+
+// eval runs the Go port of the script with sha on args: numkeys key... arg...
+func (s *Server) eval(sha string, args []string) any {
+	fn, ok := s.scripts[sha]
+	if !ok {
+		return errorReply("ERR no Go port of script " + sha + ", see Server.HandleScript")
+	}
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil || numKeys < 0 || numKeys > len(args)-1 {
+		return errorReply("ERR Number of keys can't be greater than number of args")
+	}
+
+	call := func(args ...any) (any, error) {
+		strs := make([]string, 0, len(args))
+		for _, arg := range args {
+			strs = append(strs, fmt.Sprint(arg))
+		}
+		reply := s.exec(strs)
+		switch v := reply.(type) {
+		case errorReply:
+			return nil, fmt.Errorf("%s", string(v))
+		case status:
+			return string(v), nil
+		}
+		return reply, nil
+	}
+	result, err := fn(call, args[1:1+numKeys], args[1+numKeys:])
+	if err != nil {
+		return errorReply("ERR " + err.Error())
+	}
+	switch v := result.(type) {
+	case int:
+		return int64(v)
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return nil
+	}
+	return result
+}
+
+// get returns the live entry of key, deleting it once expired.
+// Must be called with mu held.
+func (s *Server) get(key string) *entry {
+	e, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+	if !e.expires.IsZero() && !s.now().Before(e.expires) {
+		delete(s.data, key)
+		return nil
+	}
+	return e
+}
+
+// keys returns the live keys, sorted. Must be called with mu held.
+func (s *Server) keys() []string {
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		if s.get(key) != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// now returns the clock of the server. Must be called with mu held.
+func (s *Server) now() time.Time {
+	return time.Now().Add(s.offset)
+}
+
+func strings2any(strs []string) []any {
+	vals := make([]any, 0, len(strs))
+	for _, str := range strs {
+		vals = append(vals, str)
+	}
+	return vals
+}
+
+// match reports whether key matches the glob-style pattern of SCAN MATCH,
+// supporting *, ?, [...] classes with ranges and negation, and \ escapes
+func match(pattern, key string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(key); i++ {
+				if match(pattern, key[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(key) == 0 {
+				return false
+			}
+		case '[':
+			if len(key) == 0 {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				return pattern == key // Unterminated class matches literally
+			}
+			class := pattern[1 : 1+end]
+			negate := strings.HasPrefix(class, "^")
+			if negate {
+				class = class[1:]
+			}
+			matched := false
+			for i := 0; i < len(class); i++ {
+				if i+2 < len(class) && class[i+1] == '-' {
+					if class[i] <= key[0] && key[0] <= class[i+2] {
+						matched = true
+					}
+					i += 2
+				} else if class[i] == key[0] {
+					matched = true
+				}
+			}
+			if matched == negate {
+				return false
+			}
+			pattern = pattern[end+1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(key) == 0 || pattern[0] != key[0] {
+				return false
+			}
+		}
+		pattern, key = pattern[1:], key[1:]
+	}
+	return len(key) == 0
+}
@@ -0,0 +1,414 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package redistest provides an in-process fake Redis server for tests.
+// It speaks enough RESP2 to back a go-redis client: strings with TTLs,
+// sets, MULTI/EXEC transactions, SCAN and pub/sub.
+//
+// Lua is not available: EVAL and EVALSHA run Go ports of the scripts,
+// registered with HandleScript. Tests against this server therefore cover
+// the ports, not the script sources, and must pin the SHA1 digests of the
+// sources the ports were written for, so that changing a script without
+// its port fails them. Like Redis, EVALSHA fails with NOSCRIPT until the
+// source was sent with EVAL or SCRIPT LOAD.
+package redistest
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ScriptFunc implements a Lua script in Go. call runs a command like
+// redis.call, returning nil, string, int64 or []any replies, or an error
+// for error replies. The script may return the same types, int or bool.
+// Scripts run atomically with respect to other commands.
+type ScriptFunc func(call func(args ...any) (any, error), keys, args []string) (any, error)
+
+// status is a simple string reply
+type status string
+
+// errorReply is an error reply
+type errorReply string
+
+// multiReply is a sequence of replies to one command, e.g. SUBSCRIBE
+type multiReply []any
+
+// entry is a stored value: a string, or a set when set is not nil
+type entry struct {
+	str     string
+	set     map[string]struct{}
+	expires time.Time // Zero means no expiration
+}
+
+// Server is an in-process fake Redis server listening on localhost
+type Server struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu      sync.Mutex
+	data    map[string]*entry
+	scripts map[string]ScriptFunc // By SHA1 of the source
+	loaded  map[string]struct{}   // SHA1 of the sources sent by clients
+	subs    map[string]map[*conn]struct{}
+	conns   map[*conn]struct{}
+	offset  time.Duration // Added to the wall clock by FastForward
+	cursors []string      // Last key returned by SCAN, indexed by cursor-1
+}
+
+// NewServer starts a server on a random localhost port.
+// Close must be called to stop it.
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	s := Server{
+		ln:      ln,
+		data:    make(map[string]*entry),
+		scripts: make(map[string]ScriptFunc),
+		loaded:  make(map[string]struct{}),
+		subs:    make(map[string]map[*conn]struct{}),
+		conns:   make(map[*conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return &s, nil
+}
+
+// Addr returns the address of the server, for redis.Options.Addr
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Close stops the server and closes every connection
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.mu.Lock()
+	for c := range s.conns {
+		_ = c.nc.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// HandleScript serves the Lua script with SHA1 digest sha (as returned by
+// redis.Script.Hash) with fn, for EVAL and EVALSHA
+func (s *Server) HandleScript(sha string, fn ScriptFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[sha] = fn
+}
+
+// FastForward advances the clock of the server by d, expiring keys
+func (s *Server) FastForward(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset += d
+}
+
+// FlushAll deletes every key
+func (s *Server) FlushAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = make(map[string]*entry)
+}
+
+// Keys returns the live keys, sorted
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys()
+}
+
+// conn is a client connection
+type conn struct {
+	nc       net.Conn
+	wmu      sync.Mutex // Serializes replies with published messages
+	w        *bufio.Writer
+	channels map[string]struct{}
+	multi    bool
+	queued   [][]string
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := conn{nc: nc, w: bufio.NewWriter(nc), channels: make(map[string]struct{})}
+		s.mu.Lock()
+		s.conns[&c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(&c)
+		}()
+	}
+}
+
+// handle serves the commands of c until it is closed
+func (s *Server) handle(c *conn) {
+	defer func() {
+		s.mu.Lock()
+		for channel := range c.channels {
+			delete(s.subs[channel], c)
+		}
+		delete(s.conns, c)
+		s.mu.Unlock()
+		_ = c.nc.Close()
+	}()
+
+	r := bufio.NewReader(c.nc)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		reply := s.dispatch(c, args)
+
+		c.wmu.Lock()
+		if replies, ok := reply.(multiReply); ok {
+			for _, reply := range replies {
+				writeReply(c.w, reply)
+			}
+		} else {
+			writeReply(c.w, reply)
+		}
+		// Flush once the client has sent everything, so pipelines are answered in one write
+		if r.Buffered() == 0 {
+			err = c.w.Flush()
+		}
+		c.wmu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// dispatch runs the command args for c and returns its reply
+func (s *Server) dispatch(c *conn, args []string) any {
+	name := strings.ToUpper(args[0])
+
+	if c.multi {
+		switch name {
+		case "EXEC":
+			c.multi = false
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			replies := make([]any, 0, len(c.queued))
+			for _, args := range c.queued {
+				replies = append(replies, s.exec(args))
+			}
+			c.queued = nil
+			return replies
+		case "DISCARD":
+			c.multi, c.queued = false, nil
+			return status("OK")
+		case "MULTI":
+			return errorReply("ERR MULTI calls can not be nested")
+		}
+		c.queued = append(c.queued, args)
+		return status("QUEUED")
+	}
+
+	switch name {
+	case "MULTI":
+		c.multi = true
+		return status("OK")
+	case "EXEC", "DISCARD":
+		return errorReply("ERR " + name + " without MULTI")
+	case "SUBSCRIBE":
+		return s.subscribe(c, args[1:])
+	case "UNSUBSCRIBE":
+		return s.unsubscribe(c, args[1:])
+	case "PUBLISH":
+		if len(args) != 3 {
+			return wrongArgs(name)
+		}
+		return s.publish(args[1], args[2])
+	case "PING":
+		if len(c.channels) > 0 {
+			msg := ""
+			if len(args) > 1 {
+				msg = args[1]
+			}
+			return []any{"pong", msg}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exec(args)
+}
+
+func (s *Server) subscribe(c *conn, channels []string) any {
+	if len(channels) == 0 {
+		return wrongArgs("SUBSCRIBE")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	replies := make(multiReply, 0, len(channels))
+	for _, channel := range channels {
+		if s.subs[channel] == nil {
+			s.subs[channel] = make(map[*conn]struct{})
+		}
+		s.subs[channel][c] = struct{}{}
+		c.channels[channel] = struct{}{}
+		replies = append(replies, []any{"subscribe", channel, int64(len(c.channels))})
+	}
+	return replies
+}
+
+func (s *Server) unsubscribe(c *conn, channels []string) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(channels) == 0 {
+		for channel := range c.channels {
+			channels = append(channels, channel)
+		}
+		if len(channels) == 0 {
+			return []any{"unsubscribe", nil, int64(0)}
+		}
+	}
+	replies := make(multiReply, 0, len(channels))
+	for _, channel := range channels {
+		delete(s.subs[channel], c)
+		delete(c.channels, channel)
+		replies = append(replies, []any{"unsubscribe", channel, int64(len(c.channels))})
+	}
+	return replies
+}
+
+// publish delivers message to the subscribers of channel
+func (s *Server) publish(channel, message string) any {
+	s.mu.Lock()
+	receivers := make([]*conn, 0, len(s.subs[channel]))
+	for c := range s.subs[channel] {
+		receivers = append(receivers, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range receivers {
+		c.wmu.Lock()
+		writeReply(c.w, []any{"message", channel, message})
+		_ = c.w.Flush()
+		c.wmu.Unlock()
+	}
+	return int64(len(receivers))
+}
+
+// readCommand reads a command as a RESP array of bulk strings, or as an
+// inline command
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	args := make([]string, 0, max(n, 0))
+	for i := 0; i < n; i++ {
+		line, err = readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, errors.Errorf("unexpected %q, bulk string expected", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// readLine reads a CRLF terminated line without its terminator
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// writeReply encodes reply in RESP2
+func writeReply(w *bufio.Writer, reply any) {
+	switch v := reply.(type) {
+	case nil:
+		_, _ = w.WriteString("$-1\r\n")
+	case status:
+		_, _ = w.WriteString("+" + string(v) + "\r\n")
+	case errorReply:
+		_, _ = w.WriteString("-" + string(v) + "\r\n")
+	case int64:
+		_, _ = w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case string:
+		_, _ = w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+	case []any:
+		_, _ = w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, elem := range v {
+			writeReply(w, elem)
+		}
+	default:
+		writeReply(w, errorReply("ERR unsupported reply type"))
+	}
+}
+
+// sha1Hex returns the SHA1 digest of src as used by EVALSHA
+func sha1Hex(src string) string {
+	sum := sha1.Sum([]byte(src))
+	return hex.EncodeToString(sum[:])
+}
+
+func wrongArgs(name string) errorReply {
+	return errorReply("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package redistest
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func newClient(t *testing.T) (*Server, *redis.Client) {
+	s, err := NewServer()
+	assert.Nil(t, err)
+	rdb := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() {
+		_ = rdb.Close()
+		_ = s.Close()
+	})
+	return s, rdb
+}
+
+func TestStrings(t *testing.T) {
+	ctx := context.Background()
+	s, rdb := newClient(t)
+
+	assert.Nil(t, rdb.Ping(ctx).Err())
+	assert.Nil(t, rdb.Set(ctx, "a", "1", 0).Err())
+	assert.Nil(t, rdb.Set(ctx, "b", "2", time.Minute).Err())
+	assert.Nil(t, rdb.Set(ctx, "c", "3", 1500*time.Millisecond).Err())
+
+	val, err := rdb.Get(ctx, "a").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, "1", val)
+	_, err = rdb.Get(ctx, "missing").Result()
+	assert.ErrorIs(t, err, redis.Nil)
+
+	vals, err := rdb.MGet(ctx, "a", "missing", "b").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, []any{"1", nil, "2"}, vals)
+
+	ok, err := rdb.SetNX(ctx, "a", "x", time.Second).Result()
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = rdb.SetNX(ctx, "d", "4", 0).Result()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ttl, err := rdb.TTL(ctx, "b").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Minute, ttl)
+	ttl, err = rdb.TTL(ctx, "a").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(-1), ttl)
+
+	// KEEPTTL keeps the expiration of the replaced value
+	assert.Nil(t, rdb.Set(ctx, "b", "22", redis.KeepTTL).Err())
+	ttl, _ = rdb.PTTL(ctx, "b").Result()
+	assert.InDelta(t, time.Minute, ttl, float64(time.Second))
+
+	assert.Nil(t, rdb.Expire(ctx, "a", 2*time.Second).Err())
+	s.FastForward(2 * time.Second)
+	assert.Equal(t, []string{"b", "d"}, s.Keys())
+
+	n, err := rdb.Incr(ctx, "counter").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	n, err = rdb.Del(ctx, "b", "d", "missing").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+}
+
+func TestSetsAndTransactions(t *testing.T) {
+	ctx := context.Background()
+	_, rdb := newClient(t)
+
+	assert.Nil(t, rdb.SAdd(ctx, "tag", "a", "b", "a").Err())
+	var members *redis.StringSliceCmd
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		members = pipe.SMembers(ctx, "tag")
+		pipe.Del(ctx, "tag")
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, members.Val())
+	assert.Equal(t, int64(0), rdb.Exists(ctx, "tag").Val())
+
+	assert.Nil(t, rdb.Set(ctx, "str", "v", 0).Err())
+	assert.Error(t, rdb.SAdd(ctx, "str", "a").Err())
+}
+
+func TestScan(t *testing.T) {
+	ctx := context.Background()
+	_, rdb := newClient(t)
+
+	for _, key := range []string{"app:1", "app:2", "app:3", "other:1", "app*x"} {
+		assert.Nil(t, rdb.Set(ctx, key, "v", 0).Err())
+	}
+	var keys []string
+	var cursor uint64
+	for {
+		batch, next, err := rdb.Scan(ctx, cursor, "app:*", 2).Result()
+		assert.Nil(t, err)
+		keys = append(keys, batch...)
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"app:1", "app:2", "app:3"}, keys)
+
+	// Deleting returned keys mid-iteration does not skip the remaining ones
+	keys, cursor = nil, 0
+	for {
+		batch, next, err := rdb.Scan(ctx, cursor, "*", 2).Result()
+		assert.Nil(t, err)
+		keys = append(keys, batch...)
+		assert.Nil(t, rdb.Del(ctx, batch...).Err())
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"app*x", "app:1", "app:2", "app:3", "other:1"}, keys)
+
+	assert.True(t, match(`app\*x`, "app*x"))
+	assert.True(t, match("app:[12]", "app:2"))
+	assert.False(t, match("app:[^12]", "app:2"))
+	assert.True(t, match("a?p:[0-9]", "app:7"))
+}
+
+func TestScripts(t *testing.T) {
+	ctx := context.Background()
+	s, rdb := newClient(t)
+
+	script := redis.NewScript(`return redis.call('INCRBY', KEYS[1], ARGV[1])`)
+	_, err := script.Run(ctx, rdb, []string{"n"}, 2).Result()
+	assert.Error(t, err)
+
+	s.HandleScript(script.Hash(), func(call func(args ...any) (any, error), keys, args []string) (any, error) {
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < n; i++ {
+			if _, err := call("INCR", keys[0]); err != nil {
+				return nil, err
+			}
+		}
+		return call("GET", keys[0])
+	})
+	val, err := script.Run(ctx, rdb, []string{"n"}, 2).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, "2", val)
+
+	// EVALSHA only knows sources sent with EVAL or SCRIPT LOAD
+	assert.Nil(t, rdb.ScriptFlush(ctx).Err())
+	assert.Equal(t, []bool{false}, script.Exists(ctx, rdb).Val())
+	assert.True(t, redis.HasErrorPrefix(script.EvalSha(ctx, rdb, []string{"n"}, 1).Err(), "NOSCRIPT"))
+	assert.Nil(t, script.Load(ctx, rdb).Err())
+	val, err = script.EvalSha(ctx, rdb, []string{"n"}, 1).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, "3", val)
+}
+
+func TestPubSub(t *testing.T) {
+	ctx := context.Background()
+	_, rdb := newClient(t)
+
+	pubsub := rdb.Subscribe(ctx, "events")
+	defer pubsub.Close()
+	_, err := pubsub.Receive(ctx)
+	assert.Nil(t, err)
+
+	n, err := rdb.Publish(ctx, "events", "hello").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	select {
+	case msg := <-pubsub.Channel():
+		assert.Equal(t, "events", msg.Channel)
+		assert.Equal(t, "hello", msg.Payload)
+	case <-time.After(time.Second):
+		t.Fatal("message not delivered")
+	}
+	assert.Nil(t, pubsub.Ping(ctx))
+	assert.Nil(t, pubsub.Unsubscribe(ctx, "events"))
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package redis
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// slotCount is the number of hash slots of Redis Cluster
+const slotCount = 16384
+
+// hashTag returns the part of key hashed to pick its slot or shard:
+// the content of the first non-empty {...} section, or key itself
+func hashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start > -1 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
+
+// slot returns the Redis Cluster hash slot of key
+func slot(key string) int {
+	return int(crc16(hashTag(key)) % slotCount)
+}
+
+// crc16 implements the CRC16-CCITT (XMODEM) checksum used by Redis Cluster
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// batches splits the groups of partition into batches of at most the
+// batch size of c
+func (c *cache) batches(keys []string) [][]int {
+	groups := c.partition(keys)
+	if c.batchSize <= 0 {
+		return groups
+	}
+	batches := make([][]int, 0, len(groups))
+	for _, group := range groups {
+		for len(group) > c.batchSize {
+			batches = append(batches, group[:c.batchSize])
+			group = group[c.batchSize:]
+		}
+		batches = append(batches, group)
+	}
+	return batches
+}
+
+// partition groups the indexes of keys that a multi-key command may
+// address together. Redis Cluster rejects commands spanning hash slots
+// with CROSSSLOT errors, and a Ring sends a command to the shard of its
+// first key, so keys are grouped by hash slot or hash tag there.
+// Other clients talk to a single node and get one group.
+func (c *cache) partition(keys []string) [][]int {
+	var shard func(key string) string
+	switch c.rdb.(type) {
+	case *redis.ClusterClient:
+		shard = func(key string) string { return strconv.Itoa(slot(key)) }
+	case *redis.Ring:
+		shard = hashTag
+	default:
+		group := make([]int, len(keys))
+		for i := range keys {
+			group[i] = i
+		}
+		return [][]int{group}
+	}
+
+	groups := make([][]int, 0, 1)
+	byShard := make(map[string]int)
+	for i, key := range keys {
+		s := shard(key)
+		g, ok := byShard[s]
+		if !ok {
+			g = len(groups)
+			byShard[s] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package redis
+
+import (
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlot(t *testing.T) {
+	assert.Equal(t, uint16(0x31C3), crc16("123456789"))
+	assert.Equal(t, 12182, slot("foo"))
+	assert.Equal(t, slot("user1000"), slot("{user1000}.following"))
+	assert.Equal(t, slot("{user1000}.following"), slot("{user1000}.followers"))
+	assert.Equal(t, "{}foo", hashTag("{}foo")) // Empty hash tags hash the whole key
+}
+
+func TestPartition(t *testing.T) {
+	keys := []string{"{a}:1", "{b}:1", "{a}:2"}
+
+	single := NewCache(redis.NewClient(&redis.Options{}))
+	assert.Equal(t, [][]int{{0, 1, 2}}, single.partition(keys))
+
+	cluster := NewCache(redis.NewClusterClient(&redis.ClusterOptions{}))
+	assert.Equal(t, [][]int{{0, 2}, {1}}, cluster.partition(keys))
+
+	ring := NewCache(redis.NewRing(&redis.RingOptions{}))
+	assert.Equal(t, [][]int{{0, 2}, {1}}, ring.partition(keys))
+}
+
+func TestBatches(t *testing.T) {
+	keys := []string{"{a}:1", "{b}:1", "{a}:2", "{a}:3"}
+
+	single := NewCache(redis.NewClient(&redis.Options{}), WithBatchSize(3))
+	assert.Equal(t, [][]int{{0, 1, 2}, {3}}, single.batches(keys))
+
+	cluster := NewCache(redis.NewClusterClient(&redis.ClusterOptions{}), WithBatchSize(2))
+	assert.Equal(t, [][]int{{0, 2}, {3}, {1}}, cluster.batches(keys))
+
+	unlimited := NewCache(redis.NewClient(&redis.Options{}), WithBatchSize(0))
+	assert.Equal(t, [][]int{{0, 1, 2, 3}}, unlimited.batches(keys))
+
+	assert.Equal(t, []string{"{b}:1"}, Missed(keys[:2], [][]byte{{}, nil}))
+}
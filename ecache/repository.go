@@ -0,0 +1,671 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/voidint/box/constraints"
+)
+
+// Repository provides cache-aside access to one kind of entity.
+// It carries the entity type and key prefix, while settings come from
+// the Client, because Go methods cannot declare type parameters of their own.
+type Repository[T CacheableEntity[INT], INT constraints.Unsigned] struct {
+	client          *Client
+	entityKeyPrefix string
+}
+
+// NewRepository creates a repository for entities cached under entityKeyPrefix
+func NewRepository[T CacheableEntity[INT], INT constraints.Unsigned](client *Client, entityKeyPrefix string) *Repository[T, INT] {
+	return &Repository[T, INT]{
+		client:          client,
+		entityKeyPrefix: entityKeyPrefix,
+	}
+}
+
+// EntityKey returns the cache key of the entity with id
+func (r *Repository[T, INT]) EntityKey(id INT) string {
+	return r.client.Key(r.entityKeyPrefix, id)
+}
+
+// ItemsKey returns the cache key of the entity list associated with id
+func (r *Repository[T, INT]) ItemsKey(id INT) string {
+	return r.client.Key(r.entityKeyPrefix, "items", id)
+}
+
+// DelCachedEntity deletes cached data of the entity with id
+func (r *Repository[T, INT]) DelCachedEntity(ctx context.Context, id INT) (affected int64, err error) {
+	return r.client.DelCachedEntity(ctx, r.EntityKey(id))
+}
+
+// GetEntityByID implements a dual-check mechanism:
+// 1. Check cache first with singleflight deduplication
+// 2. Fallback to database on cache miss
+// 3. Repopulate cache with database result
+//
+// The cache-aside pattern prevents stale cache returns while
+// singleflight prevents cache stampede
+//
+// With negative caching enabled, a loader error classified as "not found"
+// is cached as a tombstone and ErrEntityNotFound is returned until it expires.
+//
+// With a soft expiration configured, a value past its soft expiry is
+// returned immediately while it is refreshed in the background. Callers
+// only block on the loader once the entry is gone after the hard TTL.
+//
+// The shared load is not canceled with the caller that started it, see
+// WithLoadTimeout. Each caller stops waiting when its own ctx is done.
+//
+// With WithLoadLock, loads are also deduplicated across processes: the
+// process holding the lock of key loads it, the others poll the cache.
+func (r *Repository[T, INT]) GetEntityByID(
+	ctx context.Context,
+	id INT,
+	getEntityByID func(context.Context, INT) (*T, error),
+) (*T, error) {
+	c := r.client
+
+	// 0. When cache is disabled, directly query database
+	if c.disabled {
+		one, err := getEntityByID(ctx, id)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return one, nil
+	}
+
+	// 1. First attempt to retrieve object from cache
+	key := r.EntityKey(id)
+
+	data, err := c.cache.Get(ctx, key)
+	if err != nil && !c.cache.IsKeyNotFound(err) {
+		return nil, errors.WithStack(err)
+	}
+
+	if err == nil {
+		// 2. If value exists, attempt deserialization and return object
+		if isTombstone(data) {
+			c.onHit(ctx, r.entityKeyPrefix, key)
+			return nil, errors.WithStack(ErrEntityNotFound)
+		}
+		payload, stale := c.unwrapEntry(data)
+		var one T
+		if err = c.codec.Unmarshal(payload, &one); err == nil {
+			c.onHit(ctx, r.entityKeyPrefix, key)
+			if stale {
+				// Serve the stale value and refresh it in the background,
+				// sharing the singleflight key with blocking loaders
+				c.doChan(ctx, key, func(ctx context.Context) (any, error) {
+					return r.loadEntity(ctx, key, id, getEntityByID)
+				})
+			}
+			return &one, nil
+		}
+		// If deserialization fails, continue execution flow
+		c.onDecodeError(ctx, r.entityKeyPrefix, key, err)
+	}
+	c.onMiss(ctx, r.entityKeyPrefix, key)
+
+	// 2. Query database for target ID and repopulate cache
+	entity, err := c.do(ctx, key, func(ctx context.Context) (any, error) { // Prevent cache breakdown
+		return r.loadEntity(ctx, key, id, getEntityByID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Return fetched object
+	return entity.(*T), nil
+}
+
+// loadEntity queries database for the entity with id and stores the
+// result, or a tombstone when it is classified as "not found", in cache
+func (r *Repository[T, INT]) loadEntity(
+	ctx context.Context,
+	key string,
+	id INT,
+	getEntityByID func(context.Context, INT) (*T, error),
+) (*T, error) {
+	c := r.client
+
+	// Take the load lock shared with other processes, unless the entity
+	// is cached by one of them meanwhile
+	var cached *T
+	release, found, err := c.lock(ctx, key, func(ctx context.Context) (found bool, err error) {
+		cached, found, err = r.cachedEntity(ctx, key)
+		return found, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if found {
+		if cached == nil {
+			return nil, errors.WithStack(ErrEntityNotFound)
+		}
+		return cached, nil
+	}
+
+	// Read key generation before loading, so an invalidation racing with
+	// the load discards the write below
+	version, err := c.version(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	entity, err := getEntityByID(ctx, id)
+	c.onLoad(ctx, r.entityKeyPrefix, time.Since(start), err)
+	if err != nil {
+		if c.negativeCacheEnabled() && c.isNotFound(err) {
+			// Remember the absence to shield the database from repeated lookups
+			if err = c.set(ctx, key, version, tombstone, c.ttl(c.negativeExpiration)); err != nil {
+				c.onSetError(ctx, r.entityKeyPrefix, key, err)
+				return nil, errors.WithStack(err)
+			}
+			return nil, errors.WithStack(ErrEntityNotFound)
+		}
+		return nil, errors.WithStack(err)
+	}
+
+	// Serialize object and store in cache
+	if err = r.setEntity(ctx, key, version, entity); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// cachedEntity looks up the fresh cache entry of key. A tombstone is
+// found with a nil entity. Stale and undecodable entries are not found.
+func (r *Repository[T, INT]) cachedEntity(ctx context.Context, key string) (entity *T, found bool, err error) {
+	c := r.client
+
+	data, err := c.cache.Get(ctx, key)
+	if err != nil {
+		if c.cache.IsKeyNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, errors.WithStack(err)
+	}
+	if isTombstone(data) {
+		return nil, true, nil
+	}
+	payload, stale := c.unwrapEntry(data)
+	if stale {
+		return nil, false, nil
+	}
+	var one T
+	if err = c.codec.Unmarshal(payload, &one); err != nil {
+		return nil, false, nil
+	}
+	return &one, true, nil
+}
+
+// setEntity serializes entity and stores it under key, tagged with the
+// tags of entity
+func (r *Repository[T, INT]) setEntity(ctx context.Context, key string, version uint64, entity *T) error {
+	c := r.client
+
+	data, err := c.codec.Marshal(entity)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	expire := c.ttl(c.expiration)
+	if err = c.tag(ctx, expire, entityTags(nil, key, entity)); err != nil {
+		c.onSetError(ctx, r.entityKeyPrefix, key, err)
+		return err
+	}
+	if err = c.set(ctx, key, version, c.wrapEntry(data), expire); err != nil {
+		c.onSetError(ctx, r.entityKeyPrefix, key, err)
+		return err
+	}
+	return nil
+}
+
+// SaveEntity persists entity with persist, then writes it through to the
+// cache in the format read by GetEntityByID. With WithSaveInvalidation,
+// the cache entry is deleted instead.
+//
+// The cache is left untouched when persist fails. Write-through races
+// with concurrent saves of the same entity, the last cache write wins
+// even if its persist did not.
+func (r *Repository[T, INT]) SaveEntity(ctx context.Context, entity *T, persist func(context.Context, *T) error) error {
+	c := r.client
+
+	// 0. When cache is disabled, directly persist
+	if c.disabled {
+		if err := persist(ctx, entity); err != nil {
+			return errors.WithStack(err)
+		}
+		return nil
+	}
+
+	key := r.EntityKey((*entity).ID())
+
+	// Read key generation before persisting, so an invalidation racing
+	// with the save discards the write-through below
+	version, err := c.version(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	// 1. Persist to the system of record first
+	if err = persist(ctx, entity); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// 2. Update or invalidate the cache entry
+	if c.saveInvalidation {
+		_, err = c.del(ctx, key)
+		return err
+	}
+	return r.setEntity(ctx, key, version, entity)
+}
+
+// GetEntitiesByID retrieves entity list with cache-aside pattern
+// Implements:
+// 1. Batch cache lookup with singleflight deduplication
+// 2. Database fallback on cache miss
+// 3. Cache population with serialized results
+func (r *Repository[T, INT]) GetEntitiesByID(
+	ctx context.Context,
+	id INT,
+	getEntitiesByID func(context.Context, INT) ([]*T, error),
+) ([]*T, error) {
+	var err error
+	var items []*T
+	c := r.client
+
+	// 0. When cache is disabled, directly query database
+	if c.disabled {
+		if items, err = getEntitiesByID(ctx, id); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return items, nil
+	}
+
+	// 1. Attempt to retrieve from cache first
+	key := r.ItemsKey(id)
+
+	data, err := c.cache.Get(ctx, key)
+	if err != nil && !c.cache.IsKeyNotFound(err) {
+		return nil, errors.WithStack(err)
+	}
+
+	if err == nil {
+		// 2. If cached data exists, deserialize and return the entity list
+		if err = c.codec.Unmarshal(data, &items); err == nil {
+			c.onHit(ctx, r.entityKeyPrefix, key)
+			return items, nil
+		}
+		// If deserialization fails, continue execution flow
+		c.onDecodeError(ctx, r.entityKeyPrefix, key, err)
+	}
+	c.onMiss(ctx, r.entityKeyPrefix, key)
+
+	// 2. Fallback to database query if cache miss
+	entities, err := c.do(ctx, key, func(ctx context.Context) (any, error) {
+		version, err := c.version(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		items, err := getEntitiesByID(ctx, id)
+		c.onLoad(ctx, r.entityKeyPrefix, time.Since(start), err)
+		if err != nil || len(items) == 0 {
+			return items, err
+		}
+
+		// 3. Serialize and cache results for future requests
+		data, err := c.codec.Marshal(&items)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		var keysByTag map[string][]string
+		for _, item := range items {
+			keysByTag = entityTags(keysByTag, key, item)
+		}
+		expire := c.ttl(c.expiration)
+		if err = c.tag(ctx, expire, keysByTag); err != nil {
+			c.onSetError(ctx, r.entityKeyPrefix, key, err)
+			return nil, err
+		}
+		if err = c.set(ctx, key, version, data, expire); err != nil {
+			c.onSetError(ctx, r.entityKeyPrefix, key, err)
+			return nil, err
+		}
+		return items, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entities.([]*T), nil
+}
+
+// GetEntitiesByIDs retrieves multiple entities by ID with cache-aside pattern
+// Implements:
+// 1. Single multi-get cache lookup for all IDs
+// 2. Database fallback only for the missing IDs
+// 3. Batch cache population with the loaded entities
+//
+// Results follow the order of ids. IDs absent from both cache and
+// database are skipped, and cached as tombstones when negative caching
+// is enabled. Entities written back in one batch share one jittered TTL.
+// With versioned writes, the write-back takes one guarded write per entity.
+func (r *Repository[T, INT]) GetEntitiesByIDs(
+	ctx context.Context,
+	ids []INT,
+	getEntitiesByIDs func(context.Context, []INT) (map[INT]*T, error),
+) ([]*T, error) {
+	c := r.client
+
+	if len(ids) == 0 {
+		return []*T{}, nil
+	}
+
+	// 0. When cache is disabled, directly query database
+	if c.disabled {
+		entities, err := getEntitiesByIDs(ctx, ids)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return sortEntitiesByIDs(ids, entities), nil
+	}
+
+	// 1. Attempt to retrieve all entities from cache in one round trip
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, r.EntityKey(id))
+	}
+
+	vals, err := c.cache.MGet(ctx, keys...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	entities := make(map[INT]*T, len(ids))
+	missed := make([]INT, 0, len(ids))
+	for i, id := range ids {
+		if _, ok := entities[id]; ok {
+			continue
+		}
+		if vals[i] != nil {
+			// 2. If value exists, attempt deserialization
+			if isTombstone(vals[i]) {
+				c.onHit(ctx, r.entityKeyPrefix, keys[i])
+				entities[id] = nil
+				continue
+			}
+			payload, stale := c.unwrapEntry(vals[i])
+			var one T
+			if err = c.codec.Unmarshal(payload, &one); err == nil && !stale {
+				c.onHit(ctx, r.entityKeyPrefix, keys[i])
+				entities[id] = &one
+				continue
+			}
+			// If deserialization fails or the value is stale, treat as cache miss
+			if err != nil {
+				c.onDecodeError(ctx, r.entityKeyPrefix, keys[i], err)
+			}
+		}
+		c.onMiss(ctx, r.entityKeyPrefix, keys[i])
+		entities[id] = nil
+		missed = append(missed, id)
+	}
+
+	if len(missed) > 0 {
+		// 3. Query database for the missing IDs only
+		versions, err := r.versions(ctx, missed)
+		if err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		loaded, err := getEntitiesByIDs(ctx, missed)
+		c.onLoad(ctx, r.entityKeyPrefix, time.Since(start), err)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		// 4. Serialize loaded entities and store them in cache in one batch
+		for _, id := range missed {
+			if one := loaded[id]; one != nil {
+				entities[id] = one
+			}
+		}
+		if err = r.setEntities(ctx, missed, loaded, versions); err != nil {
+			return nil, err
+		}
+	}
+
+	// 5. Return entities in input order
+	return sortEntitiesByIDs(ids, entities), nil
+}
+
+// setEntities serializes the entities loaded for ids and stores them in
+// cache in one batch. IDs absent from loaded are cached as tombstones when
+// negative caching is enabled.
+func (r *Repository[T, INT]) setEntities(ctx context.Context, ids []INT, loaded map[INT]*T, versions map[string]uint64) error {
+	c := r.client
+
+	items := make(map[string][]byte, len(loaded))
+	tombstones := make(map[string][]byte)
+	var keysByTag map[string][]string
+	for _, id := range ids {
+		key := r.EntityKey(id)
+		one, ok := loaded[id]
+		if !ok || one == nil {
+			if c.negativeCacheEnabled() {
+				tombstones[key] = tombstone
+			}
+			continue
+		}
+		data, err := c.codec.Marshal(one)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		items[key] = c.wrapEntry(data)
+		keysByTag = entityTags(keysByTag, key, one)
+	}
+	expire := c.ttl(c.expiration)
+	if err := c.tag(ctx, expire, keysByTag); err != nil {
+		r.onMSetError(ctx, items, err)
+		return err
+	}
+	if err := c.mset(ctx, items, versions, expire); err != nil {
+		r.onMSetError(ctx, items, err)
+		return err
+	}
+	if err := c.mset(ctx, tombstones, versions, c.ttl(c.negativeExpiration)); err != nil {
+		r.onMSetError(ctx, tombstones, err)
+		return err
+	}
+	return nil
+}
+
+// GetEntityByUniqueKey implements two-level cache resolution:
+// 1. UK -> PK lookup cache
+// 2. PK -> Entity cache
+// Features:
+// - Prevents cache stampede with singleflight
+// - Automatic cache population for both UK-PK and PK-Entity mappings
+//
+// ukVal only contributes to the cache key, getIDByUK is expected to
+// resolve the same value, typically as a closure over it. Structs and
+// CompositeUniqueKey values are encoded like GetEntityByCompositeKey does,
+// so InvalidateEntity finds the entry with the same UniqueKeyRef value.
+func (r *Repository[T, INT]) GetEntityByUniqueKey(
+	ctx context.Context,
+	ukKeyPrefix string,
+	ukVal any,
+	getIDByUK func(context.Context) (INT, error),
+	getEntityByID func(context.Context, INT) (*T, error),
+) (*T, error) {
+	ukKey, err := r.client.uniqueKey(ukKeyPrefix, ukVal)
+	if err != nil {
+		return nil, err
+	}
+	return r.getEntityByUniqueKey(ctx, ukKeyPrefix, ukKey, getIDByUK, getEntityByID)
+}
+
+// GetEntityByCompositeKey is GetEntityByUniqueKey for composite unique keys
+// such as (tenant_id, slug). ukVal is a struct or CompositeUniqueKey encoded
+// with EncodeUniqueKey, getIDByUK is expected to resolve the same value.
+func (r *Repository[T, INT]) GetEntityByCompositeKey(
+	ctx context.Context,
+	ukKeyPrefix string,
+	ukVal any,
+	getIDByUK func(context.Context) (INT, error),
+	getEntityByID func(context.Context, INT) (*T, error),
+) (*T, error) {
+	parts, err := EncodeUniqueKey(ukVal)
+	if err != nil {
+		return nil, err
+	}
+	ukKey := r.client.Key(append([]any{ukKeyPrefix}, parts...)...)
+	return r.getEntityByUniqueKey(ctx, ukKeyPrefix, ukKey, getIDByUK, getEntityByID)
+}
+
+// getEntityByUniqueKey resolves the entity whose unique key entry is ukKey
+func (r *Repository[T, INT]) getEntityByUniqueKey(
+	ctx context.Context,
+	ukKeyPrefix string,
+	ukKey string,
+	getIDByUK func(context.Context) (INT, error),
+	getEntityByID func(context.Context, INT) (*T, error),
+) (*T, error) {
+	c := r.client
+
+	// 0. When cache is disabled, directly query database
+	if c.disabled {
+		id, err := getIDByUK(ctx)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		one, err := getEntityByID(ctx, id)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return one, nil
+	}
+
+	// Key represents unique index value
+	// Value stores corresponding primary key ID
+	// 1. Resolve primary key ID using unique index key
+	u64ID, err := c.cache.GetAsUint64(ctx, ukKey)
+	if err == nil {
+		c.onHit(ctx, ukKeyPrefix, ukKey)
+		return r.GetEntityByID(ctx, INT(u64ID), getEntityByID)
+	}
+	if !c.cache.IsKeyNotFound(err) { // Handle unexpected errors beyond cache miss
+		return nil, errors.WithStack(err)
+	}
+	c.onMiss(ctx, ukKeyPrefix, ukKey)
+	// 2. If the primary key ID of the database table is not found, call the query function to obtain the primary key ID value.
+	start := time.Now()
+	id, err := getIDByUK(ctx)
+	c.onLoad(ctx, ukKeyPrefix, time.Since(start), err)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// 3. Persist unique index to primary key mapping
+	if err = c.cache.SetUint64(ctx, ukKey, uint64(id), -1); err != nil {
+		c.onSetError(ctx, ukKeyPrefix, ukKey, err)
+		return nil, errors.WithStack(err)
+	}
+	// 4. Retrieve entity using resolved primary key
+	return r.GetEntityByID(ctx, id, getEntityByID)
+}
+
+// UniqueKeyRef identifies a unique key entry of an entity, as written by
+// GetEntityByUniqueKey (scalar Value) or GetEntityByCompositeKey (struct or
+// CompositeUniqueKey Value)
+type UniqueKeyRef struct {
+	Prefix string
+	Value  any
+}
+
+// InvalidateEntity deletes every cache entry related to the entity with id
+// in one cache call (Del, or Invalidate with versioned writes): the entity
+// itself, the entity list associated with id and the given unique key
+// entries. Keys are built with the same format as the getters use.
+func (r *Repository[T, INT]) InvalidateEntity(ctx context.Context, id INT, uniqueKeys ...UniqueKeyRef) (affected int64, err error) {
+	return invalidateEntity(ctx, r.client, r.entityKeyPrefix, id, uniqueKeys...)
+}
+
+// invalidateEntity deletes the entity, entity list and unique key entries
+// of the entity with id
+func invalidateEntity[INT constraints.Unsigned](
+	ctx context.Context,
+	c *Client,
+	entityKeyPrefix string,
+	id INT,
+	uniqueKeys ...UniqueKeyRef,
+) (affected int64, err error) {
+	keys := make([]string, 0, 2+len(uniqueKeys))
+	keys = append(keys, c.Key(entityKeyPrefix, id), c.Key(entityKeyPrefix, "items", id))
+	for _, uk := range uniqueKeys {
+		key, err := c.uniqueKey(uk.Prefix, uk.Value)
+		if err != nil {
+			return 0, err
+		}
+		keys = append(keys, key)
+	}
+	return c.del(ctx, keys...)
+}
+
+// onMSetError reports a failed batch write for every key of items
+func (r *Repository[T, INT]) onMSetError(ctx context.Context, items map[string][]byte, err error) {
+	for key := range items {
+		r.client.onSetError(ctx, r.entityKeyPrefix, key, err)
+	}
+}
+
+// versions reads the key generations of the entities with ids when
+// versioned writes are in effect, otherwise it returns nil
+func (r *Repository[T, INT]) versions(ctx context.Context, ids []INT) (map[string]uint64, error) {
+	if r.client.versionedCache() == nil {
+		return nil, nil
+	}
+	versions := make(map[string]uint64, len(ids))
+	for _, id := range ids {
+		key := r.EntityKey(id)
+		version, err := r.client.version(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		versions[key] = version
+	}
+	return versions, nil
+}
+
+// sortEntitiesByIDs arranges entities in the order of ids, skipping absent ones
+func sortEntitiesByIDs[T any, INT constraints.Unsigned](ids []INT, entities map[INT]*T) []*T {
+	items := make([]*T, 0, len(ids))
+	for _, id := range ids {
+		if one := entities[id]; one != nil {
+			items = append(items, one)
+		}
+	}
+	return items
+}
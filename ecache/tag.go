@@ -0,0 +1,92 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tagKeyPrefix prefixes the identifiers of tag indexes
+const tagKeyPrefix = "tag"
+
+// InvalidateTag deletes every cache entry written under tag by the entity
+// helpers, see TaggedEntity, and makes every GetOrLoad result cached under
+// tag unreachable like InvalidateQueryTags does. The entries are deleted
+// like DelCachedEntity does, bumping their generations with versioned
+// writes and broadcasting them with an invalidation bus.
+//
+// Returns ErrTagsUnsupported if the cache does not implement TaggedCache,
+// see As. Query results are invalidated nonetheless.
+func (c *Client) InvalidateTag(ctx context.Context, tag string) (affected int64, err error) {
+	if c.disabled {
+		return 0, nil
+	}
+	if err = c.InvalidateQueryTags(ctx, tag); err != nil {
+		return 0, err
+	}
+	tc, ok := As[TaggedCache](c.cache)
+	if !ok {
+		return 0, errors.WithStack(ErrTagsUnsupported)
+	}
+	keys, err := tc.PopTag(ctx, c.Key(tagKeyPrefix, tag))
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return c.del(ctx, keys...)
+}
+
+// tag adds keys to the indexes of their tags before they are written.
+// Indexing first leaves no window where an entry exists but cannot be
+// found by InvalidateTag. Tags are dropped if the cache has no tag index.
+func (c *Client) tag(ctx context.Context, expire time.Duration, keysByTag map[string][]string) error {
+	tc, ok := As[TaggedCache](c.cache)
+	if !ok {
+		return nil
+	}
+	for tag, keys := range keysByTag {
+		if err := tc.Tag(ctx, c.Key(tagKeyPrefix, tag), expire, keys...); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// entityTags maps the tags of entities implementing TaggedEntity to key
+func entityTags(keysByTag map[string][]string, key string, entities ...any) map[string][]string {
+	for _, entity := range entities {
+		tagged, ok := entity.(TaggedEntity)
+		if !ok {
+			continue
+		}
+		for _, tag := range tagged.CacheTags() {
+			if keysByTag == nil {
+				keysByTag = make(map[string][]string)
+			}
+			if keys := keysByTag[tag]; len(keys) > 0 && keys[len(keys)-1] == key {
+				continue // Entity lists share one key
+			}
+			keysByTag[tag] = append(keysByTag[tag], key)
+		}
+	}
+	return keysByTag
+}
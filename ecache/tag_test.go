@@ -0,0 +1,141 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// taggedMapCache adds a tag index to mapCache
+type taggedMapCache struct {
+	*mapCache
+	tags map[string][]string
+}
+
+func (c *taggedMapCache) Tag(ctx context.Context, tag string, expire time.Duration, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tags[tag] = append(c.tags[tag], keys...)
+	return nil
+}
+
+func (c *taggedMapCache) PopTag(ctx context.Context, tag string) (keys []string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys = c.tags[tag]
+	delete(c.tags, tag)
+	return keys, nil
+}
+
+type tenantUser struct {
+	UID    uint64 `json:"id"`
+	Tenant uint64 `json:"tenant"`
+}
+
+func (u tenantUser) ID() uint64 {
+	return u.UID
+}
+
+func (u tenantUser) CacheTags() []string {
+	return []string{fmt.Sprintf("tenant:%d", u.Tenant)}
+}
+
+func TestInvalidateTag(t *testing.T) {
+	ctx := context.Background()
+	load := func(ctx context.Context, id uint64) (*tenantUser, error) {
+		return &tenantUser{UID: id, Tenant: id % 2}, nil
+	}
+
+	t.Run("Entity helpers", func(t *testing.T) {
+		cache := &taggedMapCache{mapCache: newMapCache(), tags: make(map[string][]string)}
+		c := NewClient(cache)
+		repo := NewRepository[tenantUser, uint64](c, "user")
+
+		_, err := repo.GetEntityByID(ctx, 1, load)
+		assert.Nil(t, err)
+		_, err = repo.GetEntitiesByIDs(ctx, []uint64{2, 3, 4}, func(ctx context.Context, ids []uint64) (map[uint64]*tenantUser, error) {
+			entities := make(map[uint64]*tenantUser, len(ids))
+			for _, id := range ids {
+				entities[id], _ = load(ctx, id)
+			}
+			return entities, nil
+		})
+		assert.Nil(t, err)
+		_, err = repo.GetEntitiesByID(ctx, 5, func(ctx context.Context, id uint64) ([]*tenantUser, error) {
+			return []*tenantUser{{UID: 5, Tenant: 1}, {UID: 7, Tenant: 1}}, nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"user:items:5"}, cache.tags["tag:tenant:1"][2:])
+
+		affected, err := c.InvalidateTag(ctx, "tenant:1")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(3), affected)
+		assert.NotContains(t, cache.items, "user:1")
+		assert.NotContains(t, cache.items, "user:3")
+		assert.NotContains(t, cache.items, "user:items:5")
+		assert.Contains(t, cache.items, "user:2")
+		assert.Contains(t, cache.items, "user:4")
+
+		// The index is consumed by invalidation
+		affected, err = c.InvalidateTag(ctx, "tenant:1")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), affected)
+	})
+
+	t.Run("Query results", func(t *testing.T) {
+		cache := &taggedMapCache{mapCache: newMapCache(), tags: make(map[string][]string)}
+		c := NewClient(cache)
+		repo := NewRepository[tenantUser, uint64](c, "user")
+
+		var loads int
+		query := Query[uint64]{Name: "tenant_users", Params: 1, Tags: []string{"tenant:1"}}
+		loadQuery := func(ctx context.Context) ([]uint64, error) {
+			loads++
+			return []uint64{1, 3}, nil
+		}
+		_, err := GetOrLoad(ctx, c, query, loadQuery)
+		assert.Nil(t, err)
+		_, err = repo.GetEntityByID(ctx, 1, load)
+		assert.Nil(t, err)
+
+		// One call clears the tagged entities and query results
+		affected, err := c.InvalidateTag(ctx, "tenant:1")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), affected)
+		assert.NotContains(t, cache.items, "user:1")
+		_, err = GetOrLoad(ctx, c, query, loadQuery)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, loads)
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		cache := newMapCache()
+		_, err := NewRepository[tenantUser, uint64](NewClient(cache), "user").GetEntityByID(ctx, 1, load)
+		assert.Nil(t, err)
+
+		_, err = InvalidateTag(ctx, cache, "tenant:1")
+		assert.ErrorIs(t, err, ErrTagsUnsupported)
+	})
+}
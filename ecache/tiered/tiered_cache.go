@@ -0,0 +1,371 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package tiered
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/voidint/box/ecache"
+)
+
+var (
+	_ ecache.Cache          = (*cache)(nil) // Ensure cache implements ecache.Cache interface.
+	_ ecache.VersionedCache = (*cache)(nil) // Ensure cache implements ecache.VersionedCache interface.
+	_ ecache.TaggedCache    = (*cache)(nil) // Ensure cache implements ecache.TaggedCache interface.
+	_ ecache.ExpiringCache  = (*cache)(nil) // Ensure cache implements ecache.ExpiringCache interface.
+	_ ecache.Locker         = (*cache)(nil) // Ensure cache implements ecache.Locker interface.
+	_ ecache.Unwrapper      = (*cache)(nil) // Ensure cache implements ecache.Unwrapper interface.
+)
+
+// WithL1Expiration caps the TTL of L1 entries, including entries back-filled
+// from L2: longer TTLs passed to Set are shortened to expire, and TTLs <=0
+// are replaced by it. By default L1 uses the TTL passed to Set.
+// Back-filled entries never outlive the L2 entry when L2 implements
+// ecache.ExpiringCache, otherwise they use expire, or 0 by default, which
+// lets the L1 backend apply its default expiration.
+func WithL1Expiration(expire time.Duration) func(*cache) {
+	return func(c *cache) {
+		c.l1Expiration = expire
+	}
+}
+
+// WithL2Expiration caps the TTL of L2 entries: longer TTLs passed to Set
+// are shortened to expire, and TTLs <=0 are replaced by it.
+// By default L2 uses the TTL passed to Set.
+func WithL2Expiration(expire time.Duration) func(*cache) {
+	return func(c *cache) {
+		c.l2Expiration = expire
+	}
+}
+
+// cache implements a two-tier caching solution.
+// Reads go to L1 (typically ecache/memory) first and fall back to
+// L2 (typically ecache/redis), writes and deletes go through both.
+// L1 is best-effort: its read errors are treated as misses.
+// When L2 implements ecache.ExpiringCache, back-fills take one more L2 call
+// to read the remaining TTLs of the entries.
+//
+// The optional interfaces of ecache are forwarded to L2, and are in effect
+// when L2 implements them (see ecache.As). Versioned writes and
+// invalidations also write and delete L1 entries.
+type cache struct {
+	l1           ecache.Cache
+	l2           ecache.Cache
+	l1Expiration time.Duration
+	l2Expiration time.Duration
+}
+
+// NewCache creates a two-tier cache instance.
+// l1: Fast local cache consulted first
+// l2: Shared cache consulted on L1 misses
+func NewCache(l1, l2 ecache.Cache, opts ...func(*cache)) *cache {
+	c := cache{
+		l1: l1,
+		l2: l2,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return &c
+}
+
+// capTTL returns the TTL of an entry written with expire to a tier with
+// TTL limit: a positive limit caps positive TTLs, and a non-zero limit
+// replaces TTLs <=0
+func capTTL(expire, limit time.Duration) time.Duration {
+	switch {
+	case limit == 0:
+		return expire
+	case expire <= 0:
+		return limit
+	case limit > 0:
+		return min(expire, limit)
+	}
+	return expire
+}
+
+// l1TTL returns the TTL of L1 entries for the requested expiration
+func (c *cache) l1TTL(expire time.Duration) time.Duration {
+	return capTTL(expire, c.l1Expiration)
+}
+
+// l2TTL returns the TTL of L2 entries for the requested expiration
+func (c *cache) l2TTL(expire time.Duration) time.Duration {
+	return capTTL(expire, c.l2Expiration)
+}
+
+// backfillTTLs returns the TTLs of L1 entries back-filled from L2 for keys.
+// They are capped to the remaining TTLs of the L2 entries when L2 implements
+// ecache.ExpiringCache. ok is false if these could not be read, in which
+// case nothing should be back-filled.
+func (c *cache) backfillTTLs(ctx context.Context, keys ...string) (ttls []time.Duration, ok bool) {
+	if l2, isExpiring := ecache.As[ecache.ExpiringCache](c.l2); isExpiring {
+		remaining, err := l2.TTL(ctx, keys...)
+		if err != nil {
+			return nil, false
+		}
+		ttls = remaining
+	} else {
+		ttls = make([]time.Duration, len(keys))
+	}
+	for i := range ttls {
+		ttls[i] = c.l1TTL(ttls[i])
+	}
+	return ttls, true
+}
+
+// Del removes multiple keys from both tiers.
+// Returns number of keys deleted from L2.
+func (c *cache) Del(ctx context.Context, keys ...string) (affected int64, err error) {
+	if _, err = c.l1.Del(ctx, keys...); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if affected, err = c.l2.Del(ctx, keys...); err != nil {
+		return affected, errors.WithStack(err)
+	}
+	return affected, nil
+}
+
+// Get retrieves byte slice value from L1, then from L2.
+// Values found in L2 are back-filled into L1.
+func (c *cache) Get(ctx context.Context, key string) (val []byte, err error) {
+	if val, err = c.l1.Get(ctx, key); err == nil {
+		return val, nil
+	}
+	if val, err = c.l2.Get(ctx, key); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if ttls, ok := c.backfillTTLs(ctx, key); ok {
+		_ = c.l1.Set(ctx, key, val, ttls[0])
+	}
+	return val, nil
+}
+
+// Set stores value in L2, then in L1.
+// L1 is left untouched when L2 fails, so it never holds values L2 does not.
+func (c *cache) Set(ctx context.Context, key string, val []byte, expire time.Duration) (err error) {
+	if err = c.l2.Set(ctx, key, val, c.l2TTL(expire)); err != nil {
+		return errors.WithStack(err)
+	}
+	if err = c.l1.Set(ctx, key, val, c.l1TTL(expire)); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// GetAsUint64 retrieves uint64 value from L1, then from L2.
+// Values found in L2 are back-filled into L1.
+func (c *cache) GetAsUint64(ctx context.Context, key string) (val uint64, err error) {
+	if val, err = c.l1.GetAsUint64(ctx, key); err == nil {
+		return val, nil
+	}
+	if val, err = c.l2.GetAsUint64(ctx, key); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if ttls, ok := c.backfillTTLs(ctx, key); ok {
+		_ = c.l1.SetUint64(ctx, key, val, ttls[0])
+	}
+	return val, nil
+}
+
+// SetUint64 stores uint64 value in L2, then in L1.
+func (c *cache) SetUint64(ctx context.Context, key string, val uint64, expire time.Duration) (err error) {
+	if err = c.l2.SetUint64(ctx, key, val, c.l2TTL(expire)); err != nil {
+		return errors.WithStack(err)
+	}
+	if err = c.l1.SetUint64(ctx, key, val, c.l1TTL(expire)); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// MGet retrieves values from L1, then the L1 misses from L2 in one call.
+// Values found in L2 are back-filled into L1 in one call per TTL.
+func (c *cache) MGet(ctx context.Context, keys ...string) (vals [][]byte, err error) {
+	vals, err = c.l1.MGet(ctx, keys...)
+	if err != nil {
+		vals = make([][]byte, len(keys))
+	}
+
+	missed := make([]int, 0, len(keys))
+	missedKeys := make([]string, 0, len(keys))
+	for i := range keys {
+		if vals[i] == nil {
+			missed = append(missed, i)
+			missedKeys = append(missedKeys, keys[i])
+		}
+	}
+	if len(missed) == 0 {
+		return vals, nil
+	}
+
+	l2Vals, err := c.l2.MGet(ctx, missedKeys...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	found := make([]int, 0, len(missed))
+	foundKeys := make([]string, 0, len(missed))
+	for j, i := range missed {
+		if l2Vals[j] != nil {
+			vals[i] = l2Vals[j]
+			found = append(found, i)
+			foundKeys = append(foundKeys, keys[i])
+		}
+	}
+	if len(found) == 0 {
+		return vals, nil
+	}
+	ttls, ok := c.backfillTTLs(ctx, foundKeys...)
+	if !ok {
+		return vals, nil
+	}
+	backfills := make(map[time.Duration]map[string][]byte, 1)
+	for j, i := range found {
+		if backfills[ttls[j]] == nil {
+			backfills[ttls[j]] = make(map[string][]byte)
+		}
+		backfills[ttls[j]][keys[i]] = vals[i]
+	}
+	for ttl, items := range backfills {
+		_ = c.l1.MSet(ctx, items, ttl)
+	}
+	return vals, nil
+}
+
+// MSet stores multiple values in L2, then in L1.
+func (c *cache) MSet(ctx context.Context, items map[string][]byte, expire time.Duration) (err error) {
+	if err = c.l2.MSet(ctx, items, c.l2TTL(expire)); err != nil {
+		return errors.WithStack(err)
+	}
+	if err = c.l1.MSet(ctx, items, c.l1TTL(expire)); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Unwrap returns L2, which backs the optional interfaces
+func (c *cache) Unwrap() ecache.Cache {
+	return c.l2
+}
+
+// Version retrieves the generation of key from L2.
+// Returns ecache.ErrUnsupported if L2 has no key generations.
+func (c *cache) Version(ctx context.Context, key string) (version uint64, err error) {
+	vc, ok := c.l2.(ecache.VersionedCache)
+	if !ok {
+		return 0, errors.WithStack(ecache.ErrUnsupported)
+	}
+	if version, err = vc.Version(ctx, key); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return version, nil
+}
+
+// SetIfVersion stores value in L2 if the generation of key still equals
+// version, then in L1 if it was stored.
+func (c *cache) SetIfVersion(ctx context.Context, key string, version uint64, val []byte, expire time.Duration) (ok bool, err error) {
+	vc, ok := c.l2.(ecache.VersionedCache)
+	if !ok {
+		return false, errors.WithStack(ecache.ErrUnsupported)
+	}
+	if ok, err = vc.SetIfVersion(ctx, key, version, val, c.l2TTL(expire)); err != nil || !ok {
+		return false, errors.WithStack(err)
+	}
+	if err = c.l1.Set(ctx, key, val, c.l1TTL(expire)); err != nil {
+		return true, errors.WithStack(err)
+	}
+	return true, nil
+}
+
+// Invalidate removes keys from L1, then deletes them from L2 and bumps
+// their generations.
+// Returns number of keys deleted from L2.
+func (c *cache) Invalidate(ctx context.Context, keys ...string) (affected int64, err error) {
+	vc, ok := c.l2.(ecache.VersionedCache)
+	if !ok {
+		return 0, errors.WithStack(ecache.ErrUnsupported)
+	}
+	if _, err = c.l1.Del(ctx, keys...); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if affected, err = vc.Invalidate(ctx, keys...); err != nil {
+		return affected, errors.WithStack(err)
+	}
+	return affected, nil
+}
+
+// Tag adds keys to the tag index of L2.
+// Returns ecache.ErrTagsUnsupported if L2 has no tag index.
+func (c *cache) Tag(ctx context.Context, tag string, expire time.Duration, keys ...string) (err error) {
+	tc, ok := c.l2.(ecache.TaggedCache)
+	if !ok {
+		return errors.WithStack(ecache.ErrTagsUnsupported)
+	}
+	if err = tc.Tag(ctx, tag, c.l2TTL(expire), keys...); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// PopTag retrieves and removes the tag index of L2.
+// Returns ecache.ErrTagsUnsupported if L2 has no tag index.
+func (c *cache) PopTag(ctx context.Context, tag string) (keys []string, err error) {
+	tc, ok := c.l2.(ecache.TaggedCache)
+	if !ok {
+		return nil, errors.WithStack(ecache.ErrTagsUnsupported)
+	}
+	if keys, err = tc.PopTag(ctx, tag); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return keys, nil
+}
+
+// TTL retrieves the remaining time-to-live of entries from L2.
+// Returns ecache.ErrUnsupported if L2 does not report TTLs.
+func (c *cache) TTL(ctx context.Context, keys ...string) (ttls []time.Duration, err error) {
+	ec, ok := c.l2.(ecache.ExpiringCache)
+	if !ok {
+		return nil, errors.WithStack(ecache.ErrUnsupported)
+	}
+	if ttls, err = ec.TTL(ctx, keys...); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return ttls, nil
+}
+
+// TryLock acquires lock key in L2, which is shared across processes.
+// Returns ecache.ErrUnsupported if L2 has no locks.
+func (c *cache) TryLock(ctx context.Context, key string, ttl time.Duration) (unlock func(context.Context) error, ok bool, err error) {
+	locker, ok := c.l2.(ecache.Locker)
+	if !ok {
+		return nil, false, errors.WithStack(ecache.ErrUnsupported)
+	}
+	if unlock, ok, err = locker.TryLock(ctx, key, ttl); err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	return unlock, ok, nil
+}
+
+// IsKeyNotFound checks if error represents missing key in either tier.
+func (c *cache) IsKeyNotFound(err error) bool {
+	return c.l1.IsKeyNotFound(err) || c.l2.IsKeyNotFound(err)
+}
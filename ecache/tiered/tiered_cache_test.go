@@ -0,0 +1,274 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package tiered
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/voidint/box/ecache"
+	"github.com/voidint/box/ecache/memory"
+)
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	l1 := memory.NewCache(time.Minute, 0)
+	l2 := memory.NewCache(time.Hour, 0)
+	c := NewCache(l1, l2, WithL1Expiration(time.Second))
+
+	t.Run("Set writes through both tiers", func(t *testing.T) {
+		assert.Nil(t, c.Set(ctx, "foo", []byte("bar"), time.Hour))
+		val, err := l1.Get(ctx, "foo")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("bar"), val)
+		val, err = l2.Get(ctx, "foo")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("bar"), val)
+	})
+
+	t.Run("Get back-fills L1 from L2", func(t *testing.T) {
+		assert.Nil(t, l2.Set(ctx, "l2only", []byte("v"), 0))
+		val, err := c.Get(ctx, "l2only")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("v"), val)
+		val, err = l1.Get(ctx, "l2only")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("v"), val)
+
+		_, err = c.Get(ctx, "missing")
+		assert.True(t, c.IsKeyNotFound(err))
+	})
+
+	t.Run("GetAsUint64 back-fills L1 from L2", func(t *testing.T) {
+		assert.Nil(t, l2.SetUint64(ctx, "uk", 7, -1))
+		val, err := c.GetAsUint64(ctx, "uk")
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(7), val)
+		val, err = l1.GetAsUint64(ctx, "uk")
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(7), val)
+	})
+
+	t.Run("MGet merges tiers", func(t *testing.T) {
+		assert.Nil(t, l1.Set(ctx, "a", []byte("1"), 0))
+		assert.Nil(t, l2.Set(ctx, "b", []byte("2"), 0))
+		vals, err := c.MGet(ctx, "a", "missing", "b")
+		assert.Nil(t, err)
+		assert.Equal(t, [][]byte{[]byte("1"), nil, []byte("2")}, vals)
+		val, err := l1.Get(ctx, "b")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("2"), val)
+	})
+
+	t.Run("Del removes from both tiers", func(t *testing.T) {
+		_, err := c.Del(ctx, "foo")
+		assert.Nil(t, err)
+		_, err = l1.Get(ctx, "foo")
+		assert.True(t, l1.IsKeyNotFound(err))
+		_, err = l2.Get(ctx, "foo")
+		assert.True(t, l2.IsKeyNotFound(err))
+	})
+
+	t.Run("L1 expires independently", func(t *testing.T) {
+		c := NewCache(l1, l2, WithL1Expiration(time.Millisecond))
+		assert.Nil(t, c.Set(ctx, "short", []byte("v"), time.Hour))
+		time.Sleep(5 * time.Millisecond)
+		_, err := l1.Get(ctx, "short")
+		assert.True(t, l1.IsKeyNotFound(err))
+		val, err := c.Get(ctx, "short")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("v"), val)
+	})
+}
+
+func TestExpiration(t *testing.T) {
+	ctx := context.Background()
+	l1 := memory.NewCache(time.Minute, 0)
+	l2 := memory.NewCache(time.Hour, 0)
+	c := NewCache(l1, l2, WithL1Expiration(10*time.Minute), WithL2Expiration(time.Hour))
+
+	ttl := func(cache interface {
+		TTL(context.Context, ...string) ([]time.Duration, error)
+	}, key string) time.Duration {
+		ttls, err := cache.TTL(ctx, key)
+		assert.Nil(t, err)
+		return ttls[0]
+	}
+
+	t.Run("Tier TTLs cap shorter TTLs", func(t *testing.T) {
+		assert.Nil(t, c.Set(ctx, "short", []byte("v"), 30*time.Second))
+		assert.InDelta(t, 30*time.Second, ttl(l1, "short"), float64(time.Second))
+		assert.InDelta(t, 30*time.Second, ttl(l2, "short"), float64(time.Second))
+
+		assert.Nil(t, c.SetUint64(ctx, "long", 1, 24*time.Hour))
+		assert.InDelta(t, 10*time.Minute, ttl(l1, "long"), float64(time.Second))
+		assert.InDelta(t, time.Hour, ttl(l2, "long"), float64(time.Second))
+
+		assert.Nil(t, c.MSet(ctx, map[string][]byte{"default": []byte("v")}, 0))
+		assert.InDelta(t, 10*time.Minute, ttl(l1, "default"), float64(time.Second))
+		assert.InDelta(t, time.Hour, ttl(l2, "default"), float64(time.Second))
+	})
+
+	t.Run("Back-fills do not outlive L2", func(t *testing.T) {
+		assert.Nil(t, l2.Set(ctx, "a", []byte("1"), 30*time.Second))
+		assert.Nil(t, l2.SetUint64(ctx, "b", 2, 20*time.Second))
+		assert.Nil(t, l2.MSet(ctx, map[string][]byte{"c": []byte("3"), "d": []byte("4")}, 40*time.Second))
+		assert.Nil(t, l2.Set(ctx, "e", []byte("5"), 24*time.Hour))
+
+		_, err := c.Get(ctx, "a")
+		assert.Nil(t, err)
+		_, err = c.GetAsUint64(ctx, "b")
+		assert.Nil(t, err)
+		vals, err := c.MGet(ctx, "c", "d", "e")
+		assert.Nil(t, err)
+		assert.Equal(t, [][]byte{[]byte("3"), []byte("4"), []byte("5")}, vals)
+
+		assert.InDelta(t, 30*time.Second, ttl(l1, "a"), float64(time.Second))
+		assert.InDelta(t, 20*time.Second, ttl(l1, "b"), float64(time.Second))
+		assert.InDelta(t, 40*time.Second, ttl(l1, "c"), float64(time.Second))
+		assert.InDelta(t, 40*time.Second, ttl(l1, "d"), float64(time.Second))
+		assert.InDelta(t, 10*time.Minute, ttl(l1, "e"), float64(time.Second))
+	})
+}
+
+func TestCapTTL(t *testing.T) {
+	for _, tt := range []struct {
+		expire, limit, want time.Duration
+	}{
+		{expire: time.Second, limit: 0, want: time.Second},
+		{expire: time.Second, limit: time.Minute, want: time.Second},
+		{expire: time.Hour, limit: time.Minute, want: time.Minute},
+		{expire: 0, limit: time.Minute, want: time.Minute},
+		{expire: -1, limit: time.Minute, want: time.Minute},
+		{expire: time.Second, limit: -1, want: time.Second},
+	} {
+		assert.Equal(t, tt.want, capTTL(tt.expire, tt.limit), "capTTL(%v, %v)", tt.expire, tt.limit)
+	}
+}
+
+// plainCache hides the optional interfaces of the cache it embeds
+type plainCache struct {
+	ecache.Cache
+}
+
+type tenantUser struct {
+	UID    uint64 `json:"id"`
+	Tenant string `json:"tenant"`
+}
+
+func (u tenantUser) ID() uint64 {
+	return u.UID
+}
+
+func (u tenantUser) CacheTags() []string {
+	return []string{"tenant:" + u.Tenant}
+}
+
+func TestOptionalInterfaces(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Not in effect without L2", func(t *testing.T) {
+		c := NewCache(memory.NewCache(time.Minute, 0), plainCache{memory.NewCache(time.Minute, 0)})
+		_, ok := ecache.As[ecache.VersionedCache](c)
+		assert.False(t, ok)
+		_, ok = ecache.As[ecache.TaggedCache](c)
+		assert.False(t, ok)
+		_, err := c.Version(ctx, "user:1")
+		assert.ErrorIs(t, err, ecache.ErrUnsupported)
+	})
+
+	t.Run("Forwarded to L2", func(t *testing.T) {
+		l1 := memory.NewCache(time.Minute, 0)
+		l2 := memory.NewCache(time.Hour, 0)
+		c := NewCache(l1, l2)
+		_, ok := ecache.As[ecache.VersionedCache](c)
+		assert.True(t, ok)
+
+		client := ecache.NewClient(c, ecache.WithVersionedWrites(true))
+		repo := ecache.NewRepository[tenantUser, uint64](client, "user")
+		_, err := repo.GetEntityByID(ctx, 1, func(ctx context.Context, id uint64) (*tenantUser, error) {
+			return &tenantUser{UID: id, Tenant: "acme"}, nil
+		})
+		assert.Nil(t, err)
+		_, err = l1.Get(ctx, "user:1")
+		assert.Nil(t, err)
+
+		affected, err := client.InvalidateTag(ctx, "tenant:acme")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), affected)
+		_, err = l1.Get(ctx, "user:1")
+		assert.True(t, l1.IsKeyNotFound(err))
+		_, err = l2.Get(ctx, "user:1")
+		assert.True(t, l2.IsKeyNotFound(err))
+
+		// A write based on the generation read before invalidation is discarded
+		ok, err = c.SetIfVersion(ctx, "user:1", 0, []byte("stale"), 0)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		_, err = l1.Get(ctx, "user:1")
+		assert.True(t, l1.IsKeyNotFound(err))
+	})
+}
+
+func TestQueryTagInvalidation(t *testing.T) {
+	ctx := context.Background()
+	bus := ecache.NewLocalBus()
+	l2 := memory.NewCache(0, 0)
+
+	// Two instances sharing L2, each with its own L1
+	newClient := func() (*ecache.Client, ecache.Cache) {
+		l1 := memory.NewCache(0, 0)
+		unsubscribe, err := ecache.DropOnInvalidation(ctx, bus, l1)
+		assert.Nil(t, err)
+		t.Cleanup(func() { _ = unsubscribe() })
+		return ecache.NewClient(NewCache(l1, l2), ecache.WithInvalidationBus(bus)), l1
+	}
+	a, _ := newClient()
+	b, l1b := newClient()
+
+	var loads int
+	load := func(ctx context.Context) (int, error) {
+		loads++
+		return loads, nil
+	}
+	query := ecache.Query[uint64]{Name: "products", Tags: []string{"cat:1"}}
+	assert.Nil(t, a.InvalidateQueryTags(ctx, "cat:1"))
+	for _, c := range []*ecache.Client{a, b} {
+		result, err := ecache.GetOrLoad(ctx, c, query, load)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, result)
+	}
+
+	// The version copied into L1 of b expires with the L2 version
+	ttls, err := l1b.(ecache.ExpiringCache).TTL(ctx, "query_tag:cat:1")
+	assert.Nil(t, err)
+	assert.InDelta(t, ecache.DefaultQueryTagTTL, ttls[0], float64(time.Minute))
+
+	// Invalidating through a drops the stale version from L1 of b
+	_, err = a.InvalidateTag(ctx, "cat:1")
+	assert.Nil(t, err)
+	for _, c := range []*ecache.Client{a, b} {
+		result, err := ecache.GetOrLoad(ctx, c, query, load)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, result)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// errTypedCacheDisabled is returned by Get when the client is disabled,
+	// and reported as a cache miss
+	errTypedCacheDisabled = errors.New("cache disabled")
+
+	// ErrDecode is returned by TypedCache.Get for cached data that cannot
+	// be deserialized. The codec error, such as ErrSchemaMismatch, is kept
+	// in the chain and matches with errors.Is as well.
+	ErrDecode = errors.New("cannot decode cached value")
+)
+
+// TypedCache stores values of type V under keys of type K in a Cache,
+// hiding serialization from callers. Values are serialized with the codec
+// of the client, except unsigned integers, which are stored with
+// SetUint64 like the unique key mappings of GetEntityByUniqueKey.
+// A TypedCache is safe for concurrent use.
+type TypedCache[K, V any] struct {
+	client  *Client
+	prefix  string
+	format  func(K) string
+	numeric bool
+}
+
+// NewTypedCache creates a typed cache over the cache of client.
+// prefix names the values in observer events, and builds the keys with
+// the key builder of client when format is nil.
+func NewTypedCache[K, V any](client *Client, prefix string, format func(K) string) *TypedCache[K, V] {
+	if format == nil {
+		format = func(k K) string {
+			return client.Key(prefix, k)
+		}
+	}
+	switch reflect.TypeOf((*V)(nil)).Elem().Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &TypedCache[K, V]{client: client, prefix: prefix, format: format, numeric: true}
+	}
+	return &TypedCache[K, V]{client: client, prefix: prefix, format: format}
+}
+
+// Key returns the cache key of k
+func (tc *TypedCache[K, V]) Key(k K) string {
+	return tc.format(k)
+}
+
+// Get retrieves the value of k.
+// Use IsKeyNotFound to detect cache misses. Returns ErrDecode for cached
+// data that cannot be deserialized.
+func (tc *TypedCache[K, V]) Get(ctx context.Context, k K) (val V, err error) {
+	c := tc.client
+	if c.disabled {
+		return val, errors.WithStack(errTypedCacheDisabled)
+	}
+	key := tc.Key(k)
+	if val, err = tc.get(ctx, key); err != nil {
+		if tc.IsKeyNotFound(err) {
+			c.onMiss(ctx, tc.prefix, key)
+		}
+		return val, err
+	}
+	c.onHit(ctx, tc.prefix, key)
+	return val, nil
+}
+
+// Set stores val under k with the expiration of the client
+func (tc *TypedCache[K, V]) Set(ctx context.Context, k K, val V) error {
+	if tc.client.disabled {
+		return nil
+	}
+	return tc.set(ctx, tc.Key(k), val)
+}
+
+// GetOrLoad retrieves the value of k, or loads it with load and stores it
+// on a miss. Concurrent loads of the same key are deduplicated with
+// singleflight, see Repository.GetEntityByID.
+func (tc *TypedCache[K, V]) GetOrLoad(ctx context.Context, k K, load func(context.Context, K) (V, error)) (V, error) {
+	c := tc.client
+
+	// 0. When cache is disabled, directly load
+	if c.disabled {
+		val, err := load(ctx, k)
+		if err != nil {
+			return val, errors.WithStack(err)
+		}
+		return val, nil
+	}
+
+	// 1. Attempt to retrieve from cache first
+	key := tc.Key(k)
+	val, err := tc.get(ctx, key)
+	if err == nil {
+		c.onHit(ctx, tc.prefix, key)
+		return val, nil
+	}
+	if !tc.IsKeyNotFound(err) && !errors.Is(err, ErrDecode) {
+		return val, err
+	}
+	c.onMiss(ctx, tc.prefix, key)
+
+	// 2. Fallback to loader if cache miss
+	loaded, err := c.do(ctx, key, func(ctx context.Context) (any, error) {
+		start := time.Now()
+		val, err := load(ctx, k)
+		c.onLoad(ctx, tc.prefix, time.Since(start), err)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		// 3. Store result for future requests
+		if err = tc.set(ctx, key, val); err != nil {
+			return nil, err
+		}
+		return val, nil
+	})
+	if err != nil {
+		return val, err
+	}
+	val, _ = loaded.(V) // A nil interface V stays the zero value
+	return val, nil
+}
+
+// Delete removes the values of keys like DelCachedEntity does.
+// Returns number of deleted entries.
+func (tc *TypedCache[K, V]) Delete(ctx context.Context, keys ...K) (affected int64, err error) {
+	cacheKeys := make([]string, 0, len(keys))
+	for _, k := range keys {
+		cacheKeys = append(cacheKeys, tc.Key(k))
+	}
+	return tc.client.del(ctx, cacheKeys...)
+}
+
+// IsKeyNotFound checks if error returned by Get represents a cache miss
+func (tc *TypedCache[K, V]) IsKeyNotFound(err error) bool {
+	return errors.Is(err, errTypedCacheDisabled) || tc.client.cache.IsKeyNotFound(err)
+}
+
+// get reads and deserializes the value stored under key
+func (tc *TypedCache[K, V]) get(ctx context.Context, key string) (val V, err error) {
+	c := tc.client
+
+	if tc.numeric {
+		n, err := c.cache.GetAsUint64(ctx, key)
+		if err != nil {
+			return val, errors.WithStack(err)
+		}
+		reflect.ValueOf(&val).Elem().SetUint(n)
+		return val, nil
+	}
+
+	data, err := c.cache.Get(ctx, key)
+	if err != nil {
+		return val, errors.WithStack(err)
+	}
+	if err = c.codec.Unmarshal(data, &val); err != nil {
+		c.onDecodeError(ctx, tc.prefix, key, err)
+		return val, errors.WithStack(fmt.Errorf("%w: %w", ErrDecode, err))
+	}
+	return val, nil
+}
+
+// set serializes val and stores it under key
+func (tc *TypedCache[K, V]) set(ctx context.Context, key string, val V) (err error) {
+	c := tc.client
+
+	if tc.numeric {
+		err = c.cache.SetUint64(ctx, key, reflect.ValueOf(val).Uint(), c.ttl(c.expiration))
+	} else {
+		var data []byte
+		if data, err = c.codec.Marshal(&val); err != nil {
+			return errors.WithStack(err)
+		}
+		err = c.cache.Set(ctx, key, data, c.ttl(c.expiration))
+	}
+	if err != nil {
+		c.onSetError(ctx, tc.prefix, key, err)
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypedCache(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Values", func(t *testing.T) {
+		cache := newMapCache()
+		tc := NewTypedCache[uint64, user](NewClient(cache), "user", nil)
+		assert.Equal(t, "user:1", tc.Key(1))
+
+		_, err := tc.Get(ctx, 1)
+		assert.True(t, tc.IsKeyNotFound(err))
+
+		assert.Nil(t, tc.Set(ctx, 1, user{UID: 1, Name: "foo"}))
+		one, err := tc.Get(ctx, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, "foo", one.Name)
+
+		var loads int
+		load := func(ctx context.Context, id uint64) (user, error) {
+			loads++
+			return user{UID: id, Name: "bar"}, nil
+		}
+		one, err = tc.GetOrLoad(ctx, 2, load)
+		assert.Nil(t, err)
+		assert.Equal(t, "bar", one.Name)
+		one, err = tc.GetOrLoad(ctx, 2, load)
+		assert.Nil(t, err)
+		assert.Equal(t, "bar", one.Name)
+		assert.Equal(t, 1, loads)
+
+		// Undecodable data is reloaded
+		cache.items["user:2"] = []byte("{")
+		_, err = tc.GetOrLoad(ctx, 2, load)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, loads)
+
+		affected, err := tc.Delete(ctx, 1, 2)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), affected)
+		_, err = tc.Get(ctx, 2)
+		assert.True(t, tc.IsKeyNotFound(err))
+	})
+
+	t.Run("Unique key mappings", func(t *testing.T) {
+		cache := newMapCache()
+		c := NewClient(cache)
+		repo := NewRepository[user, uint64](c, "user")
+		_, err := repo.GetEntityByUniqueKey(ctx, "user_name", "foo",
+			func(ctx context.Context) (uint64, error) { return 7, nil },
+			func(ctx context.Context, id uint64) (*user, error) { return &user{UID: id, Name: "foo"}, nil },
+		)
+		assert.Nil(t, err)
+
+		ids := NewTypedCache[string, uint64](c, "user_name", nil)
+		id, err := ids.Get(ctx, "foo")
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(7), id)
+
+		assert.Nil(t, ids.Set(ctx, "bar", 8))
+		assert.Equal(t, uint64(8), cache.items["user_name:bar"])
+	})
+
+	t.Run("Key formatter", func(t *testing.T) {
+		tc := NewTypedCache[string, []string](NewClient(newMapCache()), "roles", func(name string) string {
+			return "roles/" + name
+		})
+		assert.Equal(t, "roles/admin", tc.Key("admin"))
+	})
+
+	t.Run("Decode errors", func(t *testing.T) {
+		cache := newMapCache()
+		v1 := NewTypedCache[uint64, user](NewClient(cache, WithCodec(NewEnvelopeCodec(JSONCodec, WithSchemaVersion(1)))), "user", nil)
+		v2 := NewTypedCache[uint64, user](NewClient(cache, WithCodec(NewEnvelopeCodec(JSONCodec, WithSchemaVersion(2)))), "user", nil)
+		assert.Nil(t, v1.Set(ctx, 1, user{UID: 1}))
+
+		_, err := v2.Get(ctx, 1)
+		assert.ErrorIs(t, err, ErrDecode)
+		assert.ErrorIs(t, err, ErrSchemaMismatch)
+		assert.False(t, v2.IsKeyNotFound(err))
+	})
+
+	t.Run("Nil interface values", func(t *testing.T) {
+		tc := NewTypedCache[string, any](NewClient(newMapCache()), "any", nil)
+		val, err := tc.GetOrLoad(ctx, "nothing", func(ctx context.Context, k string) (any, error) {
+			return nil, nil
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, val)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		tc := NewTypedCache[uint64, user](NewClient(newMapCache(), WithDisabled(true)), "user", nil)
+		assert.Nil(t, tc.Set(ctx, 1, user{UID: 1}))
+		_, err := tc.Get(ctx, 1)
+		assert.True(t, tc.IsKeyNotFound(err))
+	})
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/voidint/box/constraints"
+)
+
+// ErrUnsupportedUniqueKey indicates a composite unique key that cannot be encoded
+var ErrUnsupportedUniqueKey = errors.New("unsupported composite unique key")
+
+// CompositeUniqueKey is implemented by composite unique keys that control
+// which values make up their cache key, in order
+type CompositeUniqueKey interface {
+	UniqueKeyParts() []any
+}
+
+// Tuple is an ad hoc composite unique key, e.g. Tuple{tenantID, slug}
+type Tuple []any
+
+// UniqueKeyParts returns the values of the tuple
+func (t Tuple) UniqueKeyParts() []any {
+	return t
+}
+
+// EncodeUniqueKey deterministically encodes a composite unique key into
+// cache key components. ukVal is either a CompositeUniqueKey or a struct
+// (or pointer to struct), whose exported fields are used in declaration
+// order; fields tagged `ecache:"-"` are skipped.
+//
+// Parts must be strings, booleans or integers. Strings are query-escaped,
+// so values containing the key delimiter cannot produce colliding keys.
+func EncodeUniqueKey(ukVal any) (parts []any, err error) {
+	var values []any
+	switch v := ukVal.(type) {
+	case CompositeUniqueKey:
+		values = v.UniqueKeyParts()
+	default:
+		rv := reflect.ValueOf(ukVal)
+		if rv.Kind() == reflect.Pointer && !rv.IsNil() {
+			rv = rv.Elem()
+		}
+		if rv.Kind() != reflect.Struct {
+			return nil, errors.Wrapf(ErrUnsupportedUniqueKey, "%T is neither a struct nor a CompositeUniqueKey", ukVal)
+		}
+		rt := rv.Type()
+		for i := 0; i < rt.NumField(); i++ {
+			if field := rt.Field(i); field.IsExported() && field.Tag.Get("ecache") != "-" {
+				values = append(values, rv.Field(i).Interface())
+			}
+		}
+	}
+	if len(values) == 0 {
+		return nil, errors.Wrapf(ErrUnsupportedUniqueKey, "%T has no parts", ukVal)
+	}
+
+	parts = make([]any, 0, len(values))
+	for _, value := range values {
+		part, err := encodeUniqueKeyPart(value)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// encodeUniqueKeyPart encodes one value of a composite unique key
+func encodeUniqueKeyPart(value any) (string, error) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.String:
+		return url.QueryEscape(rv.String()), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	default:
+		return "", errors.Wrapf(ErrUnsupportedUniqueKey, "unsupported part type %T", value)
+	}
+}
+
+// GetEntityByCompositeKey is GetEntityByUniqueKey for composite unique keys
+// such as (tenant_id, slug). ukVal is encoded with EncodeUniqueKey.
+func GetEntityByCompositeKey[T CacheableEntity[INT], INT constraints.Unsigned, UK any](
+	ctx context.Context,
+	cache Cache,
+	entityKeyPrefix string,
+	ukKeyPrefix string,
+	ukVal UK,
+	getIDByUK func(context.Context, UK) (INT, error),
+	getEntityByID func(context.Context, INT) (*T, error),
+) (*T, error) {
+	return NewRepository[T, INT](newDefaultClient(cache), entityKeyPrefix).GetEntityByCompositeKey(
+		ctx, ukKeyPrefix, ukVal,
+		func(ctx context.Context) (INT, error) { return getIDByUK(ctx, ukVal) },
+		getEntityByID,
+	)
+}
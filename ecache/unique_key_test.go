@@ -0,0 +1,112 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type tenantSlug struct {
+	TenantID uint32
+	Slug     string
+	note     string
+	Comment  string `ecache:"-"`
+}
+
+func TestEncodeUniqueKey(t *testing.T) {
+	t.Run("Struct", func(t *testing.T) {
+		parts, err := EncodeUniqueKey(tenantSlug{TenantID: 42, Slug: "a:b c", note: "x", Comment: "y"})
+		assert.Nil(t, err)
+		assert.Equal(t, []any{"42", "a%3Ab+c"}, parts)
+
+		ptrParts, err := EncodeUniqueKey(&tenantSlug{TenantID: 42, Slug: "a:b c"})
+		assert.Nil(t, err)
+		assert.Equal(t, parts, ptrParts)
+	})
+
+	t.Run("Tuple", func(t *testing.T) {
+		parts, err := EncodeUniqueKey(Tuple{int8(-1), true, "foo"})
+		assert.Nil(t, err)
+		assert.Equal(t, []any{"-1", "true", "foo"}, parts)
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		for _, ukVal := range []any{
+			"foo",
+			Tuple{},
+			Tuple{1.5},
+			struct{ At []string }{},
+			(*tenantSlug)(nil),
+		} {
+			_, err := EncodeUniqueKey(ukVal)
+			assert.ErrorIs(t, err, ErrUnsupportedUniqueKey)
+		}
+	})
+}
+
+func TestGetEntityByCompositeKey(t *testing.T) {
+	ctx := context.Background()
+	cache := newMapCache()
+
+	var calls int
+	getIDByUK := func(ctx context.Context, uk tenantSlug) (uint64, error) {
+		calls++
+		return uint64(uk.TenantID) * 10, nil
+	}
+	load := func(ctx context.Context, id uint64) (*user, error) {
+		return &user{UID: id}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		one, err := GetEntityByCompositeKey(ctx, cache, "user", "user:tenant_slug", tenantSlug{TenantID: 4, Slug: "foo"}, getIDByUK, load)
+		assert.Nil(t, err)
+		assert.Equal(t, &user{UID: 40}, one)
+	}
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, uint64(40), cache.items["user:tenant_slug:4:foo"])
+	assert.Contains(t, cache.items, "user:40")
+}
+
+func TestUniqueKeyInvalidation(t *testing.T) {
+	ctx := context.Background()
+	cache := newMapCache()
+	repo := NewRepository[user, uint64](NewClient(cache), "user")
+
+	uk := tenantSlug{TenantID: 4, Slug: "foo"}
+	_, err := repo.GetEntityByUniqueKey(ctx, "user:tenant_slug", uk,
+		func(ctx context.Context) (uint64, error) {
+			return 40, nil
+		},
+		func(ctx context.Context, id uint64) (*user, error) {
+			return &user{UID: id}, nil
+		},
+	)
+	assert.Nil(t, err)
+	assert.Contains(t, cache.items, "user:tenant_slug:4:foo")
+
+	// The struct value builds the same key for the getter and the invalidation
+	affected, err := repo.InvalidateEntity(ctx, 40, UniqueKeyRef{Prefix: "user:tenant_slug", Value: uk})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), affected)
+	assert.Empty(t, cache.items)
+}
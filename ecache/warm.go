@@ -0,0 +1,326 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/voidint/box/constraints"
+	"github.com/voidint/box/db"
+)
+
+const (
+	// DefaultWarmBatchSize is the default number of IDs loaded per batch
+	DefaultWarmBatchSize = 100
+	// DefaultWarmConcurrency is the default number of batches loaded concurrently
+	DefaultWarmConcurrency = 4
+)
+
+// WarmProgress reports the state of a warm-up after every batch
+type WarmProgress struct {
+	Batches int   // Batches done, failed ones included
+	Warmed  int   // Entities written to cache
+	Missing int   // IDs the loader returned no entity for
+	Failed  int   // IDs of failed batches, or page size of failed pages
+	Err     error // Error of the latest batch, nil on success
+}
+
+type warmOptions struct {
+	batchSize   int
+	concurrency int
+	progress    func(WarmProgress)
+}
+
+// WithWarmBatchSize sets the number of IDs loaded per batch, or the page
+// size of WarmPages
+func WithWarmBatchSize(size int) func(*warmOptions) {
+	return func(o *warmOptions) {
+		o.batchSize = size
+	}
+}
+
+// WithWarmConcurrency sets the number of batches loaded concurrently
+func WithWarmConcurrency(n int) func(*warmOptions) {
+	return func(o *warmOptions) {
+		o.concurrency = n
+	}
+}
+
+// WithWarmProgress sets the callback invoked after every batch.
+// Calls are serialized.
+func WithWarmProgress(fn func(WarmProgress)) func(*warmOptions) {
+	return func(o *warmOptions) {
+		o.progress = fn
+	}
+}
+
+func newWarmOptions(opts []func(*warmOptions)) warmOptions {
+	o := warmOptions{
+		batchSize:   DefaultWarmBatchSize,
+		concurrency: DefaultWarmConcurrency,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.batchSize <= 0 {
+		o.batchSize = DefaultWarmBatchSize
+	}
+	if o.concurrency <= 0 {
+		o.concurrency = 1
+	}
+	return o
+}
+
+// SliceIDs returns an iterator over ids for Warm
+func SliceIDs[INT constraints.Unsigned](ids []INT) func() (id INT, ok bool) {
+	var i int
+	return func() (id INT, ok bool) {
+		if i >= len(ids) {
+			return id, false
+		}
+		i++
+		return ids[i-1], true
+	}
+}
+
+// warmer accumulates the progress of a warm-up
+type warmer struct {
+	mu       sync.Mutex
+	state    WarmProgress
+	firstErr error
+	progress func(WarmProgress)
+}
+
+// done records a finished batch of size IDs
+func (w *warmer) done(size, warmed int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.state.Batches++
+	w.state.Err = err
+	if err != nil {
+		w.state.Failed += size
+		if w.firstErr == nil {
+			w.firstErr = err
+		}
+	} else {
+		w.state.Warmed += warmed
+		w.state.Missing += size - warmed
+	}
+	if w.progress != nil {
+		w.progress(w.state)
+	}
+}
+
+// result returns the final progress and the first batch error
+func (w *warmer) result() (WarmProgress, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.state, w.firstErr
+}
+
+// Warm preloads the entities with the IDs yielded by next into cache,
+// under the keys read by GetEntityByID. IDs are loaded in batches with
+// getEntitiesByIDs, several batches at a time, and written back like
+// GetEntitiesByIDs does. Entries already cached are overwritten.
+//
+// A failed batch does not stop the warm-up. The final progress is
+// returned with the first batch error, or the error of ctx if it was
+// canceled before all IDs were consumed.
+func (r *Repository[T, INT]) Warm(
+	ctx context.Context,
+	next func() (id INT, ok bool),
+	getEntitiesByIDs func(context.Context, []INT) (map[INT]*T, error),
+	opts ...func(*warmOptions),
+) (WarmProgress, error) {
+	if r.client.disabled {
+		return WarmProgress{}, nil
+	}
+	o := newWarmOptions(opts)
+	w := warmer{progress: o.progress}
+
+	batches := make(chan []INT)
+	var wg sync.WaitGroup
+	for i := 0; i < o.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ids := range batches {
+				warmed, err := r.warmBatch(ctx, ids, getEntitiesByIDs)
+				w.done(len(ids), warmed, err)
+			}
+		}()
+	}
+
+	var ctxErr error
+	batch := make([]INT, 0, o.batchSize)
+produce:
+	for {
+		id, ok := next()
+		if ok {
+			if batch = append(batch, id); len(batch) < o.batchSize {
+				continue
+			}
+		}
+		if len(batch) > 0 {
+			if err := ctx.Err(); err != nil {
+				ctxErr = errors.WithStack(err)
+				break
+			}
+			select {
+			case batches <- batch:
+				batch = make([]INT, 0, o.batchSize)
+			case <-ctx.Done():
+				ctxErr = errors.WithStack(ctx.Err())
+				break produce
+			}
+		}
+		if !ok {
+			break
+		}
+	}
+	close(batches)
+	wg.Wait()
+
+	state, err := w.result()
+	if ctxErr != nil {
+		return state, ctxErr
+	}
+	return state, err
+}
+
+// WarmPages preloads entities page by page, as returned by loadPage for
+// consecutive pages of the batch size. Several pages are loaded at a time.
+// Paging ends after the first page shorter than the batch size, or after
+// the first failed page as the end of the data is unknown then.
+//
+// The final progress is returned with the first page error, or the error
+// of ctx if it was canceled.
+func (r *Repository[T, INT]) WarmPages(
+	ctx context.Context,
+	loadPage func(context.Context, *db.Page[INT]) ([]*T, error),
+	opts ...func(*warmOptions),
+) (WarmProgress, error) {
+	if r.client.disabled {
+		return WarmProgress{}, nil
+	}
+	o := newWarmOptions(opts)
+	w := warmer{progress: o.progress}
+
+	var mu sync.Mutex
+	var pageNo INT
+	var last bool // Set once the end of the data is reached
+	nextPage := func() (*db.Page[INT], bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if last || ctx.Err() != nil {
+			return nil, false
+		}
+		pageNo++
+		return db.NewPage(pageNo, INT(o.batchSize)), true
+	}
+	stop := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		last = true
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < o.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				page, ok := nextPage()
+				if !ok {
+					return
+				}
+				entities, err := loadPage(ctx, page)
+				if err != nil {
+					stop()
+					w.done(int(page.PageSize()), 0, errors.WithStack(err))
+					continue
+				}
+				if len(entities) < int(page.PageSize()) {
+					stop()
+				}
+				loaded := make(map[INT]*T, len(entities))
+				ids := make([]INT, 0, len(entities))
+				for _, one := range entities {
+					if one == nil {
+						continue
+					}
+					loaded[(*one).ID()] = one
+					ids = append(ids, (*one).ID())
+				}
+				// IDs are only known after loading, so generations are
+				// read late and do not guard against racing invalidations
+				versions, err := r.versions(ctx, ids)
+				if err != nil {
+					w.done(len(ids), 0, err)
+					continue
+				}
+				warmed, err := r.storeWarmed(ctx, ids, loaded, versions)
+				w.done(len(ids), warmed, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	state, err := w.result()
+	if ctx.Err() != nil {
+		return state, errors.WithStack(ctx.Err())
+	}
+	return state, err
+}
+
+// warmBatch loads the entities with ids and stores them in cache.
+// Returns the number of entities written.
+func (r *Repository[T, INT]) warmBatch(
+	ctx context.Context,
+	ids []INT,
+	getEntitiesByIDs func(context.Context, []INT) (map[INT]*T, error),
+) (warmed int, err error) {
+	versions, err := r.versions(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+	loaded, err := getEntitiesByIDs(ctx, ids)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return r.storeWarmed(ctx, ids, loaded, versions)
+}
+
+// storeWarmed stores the entities loaded for ids in cache.
+// Returns the number of entities written.
+func (r *Repository[T, INT]) storeWarmed(ctx context.Context, ids []INT, loaded map[INT]*T, versions map[string]uint64) (warmed int, err error) {
+	if err = r.setEntities(ctx, ids, loaded, versions); err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if loaded[id] != nil {
+			warmed++
+		}
+	}
+	return warmed, nil
+}
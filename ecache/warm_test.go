@@ -0,0 +1,110 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/voidint/box/db"
+)
+
+func TestWarm(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("IDs", func(t *testing.T) {
+		cache := newMapCache()
+		repo := NewRepository[user, uint64](NewClient(cache), "user")
+
+		var mu sync.Mutex
+		var reports []WarmProgress
+		errLoad := errors.New("load failed")
+		state, err := repo.Warm(ctx, SliceIDs([]uint64{1, 2, 3, 4, 5, 6, 7}),
+			func(ctx context.Context, ids []uint64) (map[uint64]*user, error) {
+				entities := make(map[uint64]*user, len(ids))
+				for _, id := range ids {
+					if id == 7 {
+						return nil, errLoad
+					}
+					if id != 2 {
+						entities[id] = &user{UID: id}
+					}
+				}
+				return entities, nil
+			},
+			WithWarmBatchSize(3),
+			WithWarmConcurrency(2),
+			WithWarmProgress(func(p WarmProgress) {
+				mu.Lock()
+				defer mu.Unlock()
+				reports = append(reports, p)
+			}),
+		)
+		assert.ErrorIs(t, err, errLoad)
+		assert.Equal(t, 3, state.Batches)
+		assert.Equal(t, 5, state.Warmed)
+		assert.Equal(t, 1, state.Missing)
+		assert.Equal(t, 1, state.Failed)
+		assert.Equal(t, 3, len(reports))
+		for _, key := range []string{"user:1", "user:3", "user:4", "user:5", "user:6"} {
+			assert.Contains(t, cache.items, key)
+		}
+		assert.NotContains(t, cache.items, "user:2")
+
+		one, err := repo.GetEntityByID(ctx, 4, func(ctx context.Context, id uint64) (*user, error) {
+			t.Fatal("loader must not be called")
+			return nil, nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(4), one.UID)
+	})
+
+	t.Run("Pages", func(t *testing.T) {
+		cache := newMapCache()
+		repo := NewRepository[user, uint64](NewClient(cache), "user")
+
+		state, err := repo.WarmPages(ctx, func(ctx context.Context, page *db.Page[uint64]) ([]*user, error) {
+			var users []*user
+			for i := uint64(0); i < page.PageSize(); i++ {
+				if id := (page.PageNo()-1)*page.PageSize() + i + 1; id <= 10 {
+					users = append(users, &user{UID: id})
+				}
+			}
+			return users, nil
+		}, WithWarmBatchSize(4), WithWarmConcurrency(1))
+		assert.Nil(t, err)
+		assert.Equal(t, 3, state.Batches)
+		assert.Equal(t, 10, state.Warmed)
+		assert.Contains(t, cache.items, "user:10")
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		repo := NewRepository[user, uint64](NewClient(newMapCache()), "user")
+		_, err := repo.Warm(ctx, SliceIDs([]uint64{1}), func(ctx context.Context, ids []uint64) (map[uint64]*user, error) {
+			return nil, nil
+		}, WithWarmConcurrency(1))
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package ecache
+
+import "github.com/pkg/errors"
+
+// ErrUnsupported is returned by methods of an optional interface, such as
+// VersionedCache, implemented by a cache wrapper whose wrapped cache does
+// not implement it
+var ErrUnsupported = errors.New("operation not supported by the wrapped cache")
+
+// Unwrapper is implemented by caches wrapping another cache, such as
+// ecache/tiered, ecache/hotkey and ecache/breaker. They implement the
+// optional interfaces (VersionedCache, TaggedCache, ExpiringCache, Locker)
+// by forwarding to the wrapped cache, so these are in effect only if the
+// wrapped cache implements them too. See As.
+type Unwrapper interface {
+	// Unwrap returns the wrapped cache backing the optional interfaces
+	Unwrap() Cache
+}
+
+// As returns cache as the optional interface I, e.g. VersionedCache, if
+// cache implements it and, for an Unwrapper, so does the cache it wraps.
+// The Client discovers optional interfaces with As.
+func As[I any](cache Cache) (i I, ok bool) {
+	if i, ok = cache.(I); !ok {
+		return i, false
+	}
+	if w, isWrapper := cache.(Unwrapper); isWrapper {
+		if _, ok = As[I](w.Unwrap()); !ok {
+			var zero I
+			return zero, false
+		}
+	}
+	return i, true
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package ecache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// wrappingCache stands in for a wrapper implementing TaggedCache by
+// forwarding to inner
+type wrappingCache struct {
+	*taggedMapCache
+	inner Cache
+}
+
+func (c *wrappingCache) Unwrap() Cache {
+	return c.inner
+}
+
+func TestAs(t *testing.T) {
+	newTagged := func() *taggedMapCache {
+		return &taggedMapCache{mapCache: newMapCache(), tags: make(map[string][]string)}
+	}
+
+	_, ok := As[TaggedCache](newTagged())
+	assert.True(t, ok)
+	_, ok = As[TaggedCache](newMapCache())
+	assert.False(t, ok)
+
+	// Wrappers support what the caches they wrap support
+	_, ok = As[TaggedCache](&wrappingCache{taggedMapCache: newTagged(), inner: newTagged()})
+	assert.True(t, ok)
+	plain := &wrappingCache{taggedMapCache: newTagged(), inner: newMapCache()}
+	_, ok = As[TaggedCache](plain)
+	assert.False(t, ok)
+	_, ok = As[TaggedCache](&wrappingCache{taggedMapCache: newTagged(), inner: plain})
+	assert.False(t, ok)
+
+	_, err := NewClient(plain).InvalidateTag(context.Background(), "tenant:1")
+	assert.ErrorIs(t, err, ErrTagsUnsupported)
+}
@@ -0,0 +1,283 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/voidint/box/constraints"
+)
+
+var (
+	// ErrWriteBehindFull indicates the write-behind queue reached its
+	// capacity. Callers may retry or fall back to SaveEntity.
+	ErrWriteBehindFull = errors.New("write-behind queue is full")
+
+	// ErrWriteBehindClosed indicates Save was called after Close
+	ErrWriteBehindClosed = errors.New("write-behind is closed")
+)
+
+const (
+	// DefaultFlushInterval is the default interval of write-behind flushes
+	DefaultFlushInterval = time.Second
+	// DefaultFlushBatchSize is the default number of entities persisted per batch
+	DefaultFlushBatchSize = 100
+	// DefaultQueueSize is the default number of dirty entities kept before
+	// Save is rejected
+	DefaultQueueSize = 1000
+)
+
+type writeBehindOptions struct {
+	interval  time.Duration
+	batchSize int
+	queueSize int
+	onError   func(ctx context.Context, err error)
+}
+
+// WithFlushInterval sets how often dirty entities are flushed. A non-positive
+// interval uses DefaultFlushInterval.
+func WithFlushInterval(interval time.Duration) func(*writeBehindOptions) {
+	return func(o *writeBehindOptions) {
+		o.interval = interval
+	}
+}
+
+// WithFlushBatchSize sets the maximum number of entities passed to one
+// persist call. A flush starts early once this many entities are dirty.
+func WithFlushBatchSize(size int) func(*writeBehindOptions) {
+	return func(o *writeBehindOptions) {
+		o.batchSize = size
+	}
+}
+
+// WithQueueSize bounds the number of dirty entities awaiting a flush
+func WithQueueSize(size int) func(*writeBehindOptions) {
+	return func(o *writeBehindOptions) {
+		o.queueSize = size
+	}
+}
+
+// WithFlushErrorHandler sets the handler of errors from background
+// flushes, which have no caller to return them to
+func WithFlushErrorHandler(fn func(ctx context.Context, err error)) func(*writeBehindOptions) {
+	return func(o *writeBehindOptions) {
+		o.onError = fn
+	}
+}
+
+// WriteBehind updates the cache immediately and persists entities
+// asynchronously in batches. Saving the same entity repeatedly before a
+// flush persists only its latest state.
+//
+// If persisting a batch fails, its entities are queued again ahead of
+// newer ones and retried by the next flush, unless they were saved again
+// in the meantime. Entities being flushed keep their place in the queue,
+// so requeued entities always fit in it. Background flush errors are
+// reported to the flush error handler.
+type WriteBehind[T CacheableEntity[INT], INT constraints.Unsigned] struct {
+	repo    *Repository[T, INT]
+	persist func(context.Context, []*T) error
+	opts    writeBehindOptions
+
+	mu       sync.Mutex
+	dirty    map[INT]*T
+	order    []INT            // IDs of dirty in save order
+	inflight map[INT]struct{} // IDs being flushed
+	reserved int              // Number of inflight IDs not in dirty, still counted in the queue
+	closed   bool
+
+	flushMu sync.Mutex // Serializes flushes, keeping saves of an entity in order
+	kick    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewWriteBehind creates a write-behind writer persisting batches of
+// entities with persist, and starts its background flusher.
+// Close must be called to flush pending entities and stop the flusher.
+func NewWriteBehind[T CacheableEntity[INT], INT constraints.Unsigned](
+	repo *Repository[T, INT],
+	persist func(context.Context, []*T) error,
+	opts ...func(*writeBehindOptions),
+) *WriteBehind[T, INT] {
+	w := WriteBehind[T, INT]{
+		repo:    repo,
+		persist: persist,
+		opts: writeBehindOptions{
+			interval:  DefaultFlushInterval,
+			batchSize: DefaultFlushBatchSize,
+			queueSize: DefaultQueueSize,
+		},
+		dirty:    make(map[INT]*T),
+		inflight: make(map[INT]struct{}),
+		kick:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&w.opts)
+	}
+	if w.opts.interval <= 0 {
+		w.opts.interval = DefaultFlushInterval
+	}
+	if w.opts.batchSize <= 0 {
+		w.opts.batchSize = DefaultFlushBatchSize
+	}
+	go w.run()
+	return &w
+}
+
+// Save writes entity to the cache and queues it for persisting.
+// Returns ErrWriteBehindFull when the queue is at capacity and entity is
+// not already queued, and ErrWriteBehindClosed after Close. The entity
+// stays queued if only the cache write fails.
+func (w *WriteBehind[T, INT]) Save(ctx context.Context, entity *T) error {
+	id := (*entity).ID()
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return errors.WithStack(ErrWriteBehindClosed)
+	}
+	if _, ok := w.dirty[id]; !ok {
+		if _, ok = w.inflight[id]; ok {
+			w.reserved-- // The place of the flushed entity is taken over
+		} else if w.opts.queueSize > 0 && len(w.dirty)+w.reserved >= w.opts.queueSize {
+			w.mu.Unlock()
+			return errors.WithStack(ErrWriteBehindFull)
+		}
+		w.order = append(w.order, id)
+	}
+	w.dirty[id] = entity
+	pending := len(w.dirty)
+	w.mu.Unlock()
+
+	if pending >= w.opts.batchSize {
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+	}
+
+	if c := w.repo.client; !c.disabled {
+		key := w.repo.EntityKey(id)
+		version, err := c.version(ctx, key)
+		if err != nil {
+			return err
+		}
+		return w.repo.setEntity(ctx, key, version, entity)
+	}
+	return nil
+}
+
+// Flush persists every entity queued so far.
+// The first persist error is returned after all batches were attempted,
+// the entities of failed batches being queued again.
+func (w *WriteBehind[T, INT]) Flush(ctx context.Context) error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	entities := make([]*T, 0, len(w.order))
+	for _, id := range w.order {
+		entities = append(entities, w.dirty[id])
+		w.inflight[id] = struct{}{}
+	}
+	w.reserved = len(w.inflight)
+	w.dirty = make(map[INT]*T)
+	w.order = nil
+	w.mu.Unlock()
+
+	var firstErr error
+	var failed []*T
+	for start := 0; start < len(entities); start += w.opts.batchSize {
+		end := min(start+w.opts.batchSize, len(entities))
+		if err := w.persist(ctx, entities[start:end]); err != nil {
+			failed = append(failed, entities[start:end]...)
+			if firstErr == nil {
+				firstErr = errors.WithStack(err)
+			}
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	requeued := make([]INT, 0, len(failed))
+	for _, entity := range failed {
+		id := (*entity).ID()
+		if _, ok := w.dirty[id]; !ok { // Not saved again while flushing
+			w.dirty[id] = entity
+			requeued = append(requeued, id)
+		}
+	}
+	w.order = append(requeued, w.order...)
+	w.inflight = make(map[INT]struct{})
+	w.reserved = 0
+	return firstErr
+}
+
+// Close stops the background flusher and flushes pending entities.
+// Save fails with ErrWriteBehindClosed afterwards. If some entities could
+// not be persisted, Close returns the persist error and keeps them queued,
+// so Flush can be called again to retry them.
+func (w *WriteBehind[T, INT]) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.stop)
+	<-w.done
+	return w.Flush(ctx)
+}
+
+// Pending returns the number of entities awaiting a flush or being flushed
+func (w *WriteBehind[T, INT]) Pending() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.dirty) + w.reserved
+}
+
+// run flushes on every tick, or early when a batch is full, until Close
+func (w *WriteBehind[T, INT]) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.opts.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		case <-w.kick:
+		}
+		ctx := context.Background()
+		if err := w.Flush(ctx); err != nil && w.opts.onError != nil {
+			w.opts.onError(ctx, err)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2025 voidint <voidint@126.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package ecache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveEntity(t *testing.T) {
+	ctx := context.Background()
+	persisted := make(map[uint64]string)
+	persist := func(ctx context.Context, u *user) error {
+		persisted[u.UID] = u.Name
+		return nil
+	}
+	load := func(ctx context.Context, id uint64) (*user, error) {
+		return &user{UID: id, Name: persisted[id]}, nil
+	}
+
+	t.Run("Write-through", func(t *testing.T) {
+		cache := newMapCache()
+		repo := NewRepository[user, uint64](NewClient(cache), "user")
+
+		assert.Nil(t, repo.SaveEntity(ctx, &user{UID: 1, Name: "foo"}, persist))
+		assert.Equal(t, "foo", persisted[1])
+		assert.Contains(t, cache.items, "user:1")
+
+		one, err := repo.GetEntityByID(ctx, 1, func(ctx context.Context, id uint64) (*user, error) {
+			t.Fatal("loader must not be called")
+			return nil, nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "foo", one.Name)
+	})
+
+	t.Run("Invalidation", func(t *testing.T) {
+		cache := newMapCache()
+		repo := NewRepository[user, uint64](NewClient(cache, WithSaveInvalidation(true)), "user")
+
+		_, err := repo.GetEntityByID(ctx, 1, load)
+		assert.Nil(t, err)
+		assert.Nil(t, repo.SaveEntity(ctx, &user{UID: 1, Name: "bar"}, persist))
+		assert.NotContains(t, cache.items, "user:1")
+
+		one, err := repo.GetEntityByID(ctx, 1, load)
+		assert.Nil(t, err)
+		assert.Equal(t, "bar", one.Name)
+	})
+
+	t.Run("Persist error", func(t *testing.T) {
+		cache := newMapCache()
+		errPersist := errors.New("persist failed")
+		err := SaveEntity[user, uint64](ctx, cache, "user", &user{UID: 2}, func(ctx context.Context, u *user) error {
+			return errPersist
+		})
+		assert.ErrorIs(t, err, errPersist)
+		assert.Equal(t, 0, len(cache.items))
+	})
+}
+
+func TestWriteBehind(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var batches [][]*user
+	persist := func(ctx context.Context, users []*user) error {
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, users)
+		return nil
+	}
+
+	t.Run("Flush on close", func(t *testing.T) {
+		batches = nil
+		cache := newMapCache()
+		repo := NewRepository[user, uint64](NewClient(cache), "user")
+		w := NewWriteBehind(repo, persist, WithFlushInterval(time.Hour), WithFlushBatchSize(2), WithQueueSize(3))
+
+		assert.Nil(t, w.Save(ctx, &user{UID: 1, Name: "a"}))
+		assert.Nil(t, w.Save(ctx, &user{UID: 1, Name: "b"})) // Coalesced with the first save
+		assert.Contains(t, cache.items, "user:1")
+		assert.Equal(t, 1, w.Pending())
+
+		assert.Nil(t, w.Close(ctx))
+		assert.Equal(t, 0, w.Pending())
+		assert.Equal(t, 1, len(batches))
+		assert.Equal(t, "b", batches[0][0].Name)
+		assert.ErrorIs(t, w.Save(ctx, &user{UID: 2}), ErrWriteBehindClosed)
+	})
+
+	t.Run("Bounded queue", func(t *testing.T) {
+		batches = nil
+		repo := NewRepository[user, uint64](NewClient(newMapCache()), "user")
+		w := NewWriteBehind(repo, persist, WithFlushInterval(time.Hour), WithFlushBatchSize(10), WithQueueSize(2))
+
+		assert.Nil(t, w.Save(ctx, &user{UID: 1}))
+		assert.Nil(t, w.Save(ctx, &user{UID: 2}))
+		assert.ErrorIs(t, w.Save(ctx, &user{UID: 3}), ErrWriteBehindFull)
+		assert.Nil(t, w.Save(ctx, &user{UID: 2, Name: "updated"}))
+
+		assert.Nil(t, w.Flush(ctx))
+		assert.Equal(t, 1, len(batches))
+		assert.Equal(t, 2, len(batches[0]))
+		assert.Nil(t, w.Save(ctx, &user{UID: 3}))
+		assert.Nil(t, w.Close(ctx))
+	})
+
+	t.Run("Invalid interval", func(t *testing.T) {
+		for _, interval := range []time.Duration{0, -time.Second} {
+			batches = nil
+			repo := NewRepository[user, uint64](NewClient(newMapCache()), "user")
+			w := NewWriteBehind(repo, persist, WithFlushInterval(interval))
+			assert.Equal(t, DefaultFlushInterval, w.opts.interval)
+
+			assert.Nil(t, w.Save(ctx, &user{UID: 1}))
+			assert.Nil(t, w.Close(ctx))
+			assert.Equal(t, 1, len(batches))
+		}
+	})
+
+	t.Run("Background flush", func(t *testing.T) {
+		batches = nil
+		repo := NewRepository[user, uint64](NewClient(newMapCache()), "user")
+		w := NewWriteBehind(repo, persist, WithFlushInterval(time.Hour), WithFlushBatchSize(2))
+		defer w.Close(ctx)
+
+		assert.Nil(t, w.Save(ctx, &user{UID: 1}))
+		assert.Nil(t, w.Save(ctx, &user{UID: 2}))
+		assert.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(batches) == 1
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("Persist error", func(t *testing.T) {
+		cache := newMapCache()
+		repo := NewRepository[user, uint64](NewClient(cache), "user")
+		errPersist := errors.New("persist failed")
+		var failing, racing bool
+		var persisted []*user
+		var w *WriteBehind[user, uint64]
+		w = NewWriteBehind(repo, func(ctx context.Context, users []*user) error {
+			if racing {
+				// Saves racing with the flush take the place of their entity
+				assert.Nil(t, w.Save(ctx, &user{UID: 2, Name: "newer"}))
+				assert.Nil(t, w.Save(ctx, &user{UID: 3}))
+				assert.ErrorIs(t, w.Save(ctx, &user{UID: 4}), ErrWriteBehindFull)
+			}
+			if failing {
+				return errPersist
+			}
+			persisted = append(persisted, users...)
+			return nil
+		}, WithFlushInterval(time.Hour), WithQueueSize(3))
+
+		failing, racing = true, true
+		assert.Nil(t, w.Save(ctx, &user{UID: 1}))
+		assert.Nil(t, w.Save(ctx, &user{UID: 2}))
+		assert.ErrorIs(t, w.Flush(ctx), errPersist)
+		assert.Equal(t, 3, w.Pending())
+		assert.Contains(t, cache.items, "user:1")
+
+		// Failed entities are retried first, unless saved again
+		failing, racing = false, false
+		assert.Nil(t, w.Flush(ctx))
+		assert.Equal(t, 0, w.Pending())
+		assert.Equal(t, []*user{{UID: 1}, {UID: 2, Name: "newer"}, {UID: 3}}, persisted)
+
+		// Close reports entities left unpersisted, which Flush can retry
+		assert.Nil(t, w.Save(ctx, &user{UID: 5}))
+		failing = true
+		assert.ErrorIs(t, w.Close(ctx), errPersist)
+		assert.Equal(t, 1, w.Pending())
+		failing = false
+		assert.Nil(t, w.Flush(ctx))
+		assert.Equal(t, 0, w.Pending())
+		assert.Equal(t, uint64(5), persisted[len(persisted)-1].UID)
+	})
+}
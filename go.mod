@@ -1,6 +1,6 @@
 module github.com/voidint/box
 
-go 1.20
+go 1.21
 
 require (
 	github.com/BurntSushi/toml v1.5.0